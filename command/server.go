@@ -93,6 +93,8 @@ func connectAdminClient(port int64, path string, adminUser *user.UserClient) err
 		Host:     "127.0.0.1",
 		Port:     int(port),
 		Path:     path,
+		// in-process, never through proxies of the environment
+		RelayProxy: core.RelayProxyDirect,
 		User: &user.User{
 			ClientID:     adminUser.ClientID,
 			ClientSecret: adminUser.ClientSecret,
@@ -0,0 +1,91 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-zoox/cli"
+	"github.com/go-zoox/gzfly/core"
+)
+
+func RegisterToken(app *cli.MultipleProgram) {
+	app.Register("token", &cli.Command{
+		Name:  "token",
+		Usage: "issue a token for client authentication, signed with the token secret of the server",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "config",
+				Usage:   "the filepath for server configuration",
+				Aliases: []string{"c"},
+			},
+			&cli.StringFlag{
+				Name:     "client",
+				Usage:    "the client id of the token, must be in clients of the server",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "ttl",
+				Usage: "how long the token is valid, example: 8h",
+				Value: "24h",
+			},
+			&cli.StringFlag{
+				Name:  "targets",
+				Usage: "comma separated client ids the client may connect to, all by default",
+			},
+			&cli.StringFlag{
+				Name:  "audience",
+				Usage: "the audience of the token, the audience of the server by default",
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			cfg := &core.ServerConfig{}
+			if err := cli.LoadConfig(ctx, cfg, &cli.LoadConfigOptions{
+				Required: true,
+				FilePath: ctx.String("config"),
+			}); err != nil {
+				return fmt.Errorf("failed to load config file: %v", err)
+			}
+
+			found := false
+			for _, u := range cfg.Users {
+				found = found || u.ClientID == ctx.String("client")
+			}
+			if !found {
+				return fmt.Errorf("unknown client: %s", ctx.String("client"))
+			}
+
+			ttl, err := time.ParseDuration(ctx.String("ttl"))
+			if err != nil || ttl <= 0 {
+				return fmt.Errorf("invalid ttl: %s", ctx.String("ttl"))
+			}
+
+			audience := cfg.Token.Audience
+			if ctx.String("audience") != "" {
+				audience = ctx.String("audience")
+			}
+
+			var targets []string
+			if ctx.String("targets") != "" {
+				for _, target := range strings.Split(ctx.String("targets"), ",") {
+					if target = strings.TrimSpace(target); target != "" {
+						targets = append(targets, target)
+					}
+				}
+			}
+
+			token, err := core.IssueToken(cfg.Token.Secret, &core.TokenClaims{
+				UserClientID: ctx.String("client"),
+				Audience:     audience,
+				ExpiresAt:    time.Now().Add(ttl),
+				Targets:      targets,
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(token)
+			return nil
+		},
+	})
+}
@@ -2,11 +2,16 @@ package command
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-zoox/gzfly/core"
+	"github.com/go-zoox/gzfly/network"
+	"github.com/go-zoox/gzfly/network/upstream"
+	"github.com/go-zoox/gzfly/router"
 	"github.com/go-zoox/gzfly/user"
 )
 
@@ -48,6 +53,42 @@ func parseRelay(relayR string) (protocol string, host string, port int, path str
 	return
 }
 
+// parseRelays parses the relays of config, Relays if any, otherwise Relay.
+func parseRelays(cfg *ClientCLIConfig) ([]*core.Relay, error) {
+	configs := cfg.Relays
+	if len(configs) == 0 {
+		configs = []RelayConfig{{URL: cfg.Relay}}
+	}
+
+	relays := []*core.Relay{}
+	for _, rc := range configs {
+		protocol, host, port, path, err := parseRelay(rc.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relay(%s): %v", rc.URL, err)
+		}
+
+		relays = append(relays, &core.Relay{
+			Protocol: protocol,
+			Host:     host,
+			Port:     port,
+			Path:     path,
+			Priority: rc.Priority,
+		})
+	}
+
+	return relays, nil
+}
+
+// parseHeader parses the header in format of name: value.
+func parseHeader(header string) (string, string, error) {
+	name, value, ok := strings.Cut(header, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return "", "", fmt.Errorf("invalid header(%s), format: name: value", header)
+	}
+
+	return strings.TrimSpace(name), strings.TrimSpace(value), nil
+}
+
 func parseTarget(target string) (*core.Target, error) {
 	parts := strings.Split(target, ":")
 	if len(parts) != 2 {
@@ -60,44 +101,260 @@ func parseTarget(target string) (*core.Target, error) {
 	}, nil
 }
 
+func parseDialOptions(cfg *ClientCLIConfig) (*network.DialOptions, error) {
+	options := &network.DialOptions{
+		Nagle:     cfg.DialNagle,
+		SourceIP:  cfg.DialSourceIP,
+		Interface: cfg.DialInterface,
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		to    *time.Duration
+	}{
+		{"dial timeout", cfg.DialTimeout, &options.Timeout},
+		{"dial keepalive", cfg.DialKeepAlive, &options.KeepAlive},
+		{"dial fallback delay", cfg.DialFallbackDelay, &options.FallbackDelay},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", d.name, err)
+		}
+		*d.to = duration
+	}
+
+	if options.SourceIP != "" && net.ParseIP(options.SourceIP) == nil {
+		return nil, fmt.Errorf("invalid dial source ip: %s", options.SourceIP)
+	}
+
+	return options, nil
+}
+
+// parseEgress returns nil if no upstream proxy is configured.
+func parseEgress(cfg *ClientCLIConfig) (*core.Egress, error) {
+	if cfg.EgressProxy == "" && cfg.EgressRules == "" {
+		return nil, nil
+	}
+
+	egress := &core.Egress{
+		Proxies: map[string]*upstream.Proxy{},
+	}
+
+	if cfg.EgressProxy != "" {
+		proxy, err := upstream.Parse(cfg.EgressProxy)
+		if err != nil {
+			return nil, err
+		}
+		egress.Proxy = proxy
+	}
+
+	for name, proxyX := range cfg.Proxies {
+		proxy, err := upstream.Parse(proxyX)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy(%s): %v", name, err)
+		}
+		egress.Proxies[name] = proxy
+	}
+
+	if cfg.EgressRules != "" {
+		actions := []string{router.ActionProxy}
+		for name := range egress.Proxies {
+			actions = append(actions, name)
+		}
+
+		rules, err := router.New(cfg.EgressRules, actions...)
+		if err != nil {
+			return nil, err
+		}
+		go rules.Watch(5 * time.Second)
+
+		egress.Router = rules
+	}
+
+	return egress, nil
+}
+
 func parseSocks5(address string) (*core.Socks5, error) {
-	parts := strings.Split(address, ":")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid socks5")
+	host, portS, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid socks5: %v", err)
 	}
 
-	port, err := strconv.Atoi(parts[1])
+	port, err := strconv.Atoi(portS)
 	if err != nil {
 		return nil, fmt.Errorf("invalid socks5 port")
 	}
 
 	return &core.Socks5{
-		IP:   parts[0],
+		IP:   host,
+		Port: port,
+	}, nil
+}
+
+func parseTransparent(address string) (*core.Transparent, error) {
+	host, portS, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transparent: %v", err)
+	}
+
+	port, err := strconv.Atoi(portS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid transparent port")
+	}
+
+	return &core.Transparent{
+		IP:   host,
+		Port: port,
+	}, nil
+}
+
+func parseDNS(address string) (*core.DNS, error) {
+	host, portS, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dns: %v", err)
+	}
+
+	port, err := strconv.Atoi(portS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dns port")
+	}
+
+	return &core.DNS{
+		IP:   host,
 		Port: port,
 	}, nil
 }
 
 func parseBind(bind string) (*core.Bind, error) {
-	parts := strings.Split(bind, ":")
-	if len(parts) != 5 {
+	parts := splitAddress(bind)
+	if len(parts) < 3 {
 		return nil, fmt.Errorf("invalid bind")
 	}
 
-	LocalPort, err := strconv.Atoi(parts[2])
+	Network := parts[0]
+	LocalHost, LocalPort, parts, err := parseEndpoint(Network, parts[1:])
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse local port: %v", err)
+		return nil, fmt.Errorf("failed to parse local: %v", err)
 	}
 
-	RemotePort, err := strconv.Atoi(parts[4])
+	RemoteHost, RemotePort, parts, err := parseEndpoint(Network, parts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse remote port: %v", err)
+		return nil, fmt.Errorf("failed to parse remote: %v", err)
+	}
+
+	if len(parts) != 0 {
+		return nil, fmt.Errorf("invalid bind")
 	}
 
 	return &core.Bind{
-		Network:    parts[0],
-		LocalHost:  parts[1],
+		Network:    Network,
+		LocalHost:  LocalHost,
 		LocalPort:  LocalPort,
-		RemoteHost: parts[3],
+		RemoteHost: RemoteHost,
 		RemotePort: RemotePort,
 	}, nil
 }
+
+// parseEndpoint parses host:port from the head of parts, or a socket path for unix,
+// paths contain a slash, such as /var/run/docker.sock or ./app.sock.
+func parseEndpoint(network string, parts []string) (host string, port int, rest []string, err error) {
+	if network == "unix" && len(parts) > 0 && strings.Contains(parts[0], "/") {
+		return parts[0], 0, parts[1:], nil
+	}
+
+	if len(parts) < 2 {
+		return "", 0, nil, fmt.Errorf("missing port")
+	}
+
+	port, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("invalid port: %v", err)
+	}
+
+	return strings.Trim(parts[0], "[]"), port, parts[2:], nil
+}
+
+func parseRemoteBind(bind string) (*core.RemoteBind, error) {
+	b, err := parseBind(bind)
+	if err != nil {
+		return nil, fmt.Errorf("invalid remote bind: %v", err)
+	}
+
+	// same format as bind, the listening side goes first
+	return &core.RemoteBind{
+		Network:    b.Network,
+		RemoteHost: b.LocalHost,
+		RemotePort: b.LocalPort,
+		LocalHost:  b.RemoteHost,
+		LocalPort:  b.RemotePort,
+	}, nil
+}
+
+// splitAddress splits s by colon, but keeps the colons of IPv6 hosts in brackets,
+// example: tcp:[::1]:8022:[fd00::2]:22 => [tcp, [::1], 8022, [fd00::2], 22]
+func splitAddress(s string) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// redacted replaces secrets in printed configs
+const redacted = "xxxxx"
+
+// redactConfig returns a copy of cfg to print, without the token and the userinfo of proxies.
+func redactConfig(cfg *ClientCLIConfig) *ClientCLIConfig {
+	c := *cfg
+	if c.Token != "" {
+		c.Token = redacted
+	}
+
+	c.RelayProxy = redactURL(cfg.RelayProxy)
+	c.EgressProxy = redactURL(cfg.EgressProxy)
+	if cfg.Proxies != nil {
+		c.Proxies = make(map[string]string, len(cfg.Proxies))
+		for name, proxy := range cfg.Proxies {
+			c.Proxies[name] = redactURL(proxy)
+		}
+	}
+
+	return &c
+}
+
+// redactURL hides the userinfo of url, invalid urls are hidden entirely.
+func redactURL(s string) string {
+	if s == "" {
+		return s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return redacted
+	}
+
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+
+	return u.String()
+}
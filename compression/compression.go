@@ -0,0 +1,146 @@
+package compression
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/klauspost/compress"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithms, used as the COMPRESS byte of base packet,
+// each frame tells how its DATA is compressed.
+const (
+	None   uint8 = 0x00
+	Zstd   uint8 = 0x01
+	Snappy uint8 = 0x02
+)
+
+// MinSize is the minimum size of data worth compressing.
+const MinSize = 256
+
+// MaxDecodedSize limits the decoded size of a frame.
+const MaxDecodedSize = 4 << 20
+
+// sampleSize is the size of data to estimate compressibility with.
+const sampleSize = 4096
+
+var (
+	encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+	decoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(MaxDecodedSize))
+)
+
+// Parse parses the algorithm name: none, zstd or snappy.
+func Parse(name string) (uint8, error) {
+	switch name {
+	case "", "none":
+		return None, nil
+	case "zstd":
+		return Zstd, nil
+	case "snappy":
+		return Snappy, nil
+	default:
+		return None, fmt.Errorf("unknown compression: %s, only support zstd/snappy", name)
+	}
+}
+
+// ParseList parses comma separated algorithm names in preference order, such as zstd,snappy.
+func ParseList(names string) ([]uint8, error) {
+	algorithms := []uint8{}
+	for _, name := range strings.Split(names, ",") {
+		algorithm, err := Parse(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+
+		if algorithm != None {
+			algorithms = append(algorithms, algorithm)
+		}
+	}
+
+	return algorithms, nil
+}
+
+// Name returns the name of algorithm, used in logs.
+func Name(algorithm uint8) string {
+	switch algorithm {
+	case None:
+		return "none"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("unknown(%d)", algorithm)
+	}
+}
+
+// Select returns the first algorithm peer accepts which we support too,
+// peer lists them in its preference order.
+func Select(local, peer []uint8) uint8 {
+	for _, p := range peer {
+		for _, l := range local {
+			if p == l {
+				return p
+			}
+		}
+	}
+
+	return None
+}
+
+// Compress compresses data with algorithm, data is returned as is with None
+// when it is too small, looks already compressed, or does not get smaller.
+func Compress(algorithm uint8, data []byte) (uint8, []byte) {
+	if algorithm == None || len(data) < MinSize {
+		return None, data
+	}
+
+	sample := data
+	if len(sample) > sampleSize {
+		sample = sample[:sampleSize]
+	}
+	// such as images, archives and tls records
+	if compress.Estimate(sample) < 0.1 {
+		return None, data
+	}
+
+	var compressed []byte
+	switch algorithm {
+	case Zstd:
+		compressed = encoder.EncodeAll(data, nil)
+	case Snappy:
+		compressed = snappy.Encode(nil, data)
+	default:
+		return None, data
+	}
+
+	if len(compressed) >= len(data) {
+		return None, data
+	}
+
+	return algorithm, compressed
+}
+
+// Decompress decompresses data compressed with algorithm.
+func Decompress(algorithm uint8, data []byte) ([]byte, error) {
+	switch algorithm {
+	case None:
+		return data, nil
+	case Zstd:
+		return decoder.DecodeAll(data, nil)
+	case Snappy:
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if n > MaxDecodedSize {
+			return nil, fmt.Errorf("decoded size too large: %d", n)
+		}
+
+		return snappy.Decode(nil, data)
+	default:
+		return nil, fmt.Errorf("unknown compression: %d", algorithm)
+	}
+}
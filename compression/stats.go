@@ -0,0 +1,52 @@
+package compression
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Stats counts the bytes before and after compression.
+type Stats struct {
+	// Raw is the bytes written
+	Raw atomic.Uint64
+	// Sent is the bytes sent after compression
+	Sent atomic.Uint64
+	// Skipped is the frames sent as is
+	Skipped atomic.Uint64
+}
+
+// Add counts a frame of raw bytes sent as sent bytes.
+func (s *Stats) Add(raw, sent int, compressed bool) {
+	s.Raw.Add(uint64(raw))
+	s.Sent.Add(uint64(sent))
+	if !compressed {
+		s.Skipped.Add(1)
+	}
+}
+
+// Merge adds the counters of other.
+func (s *Stats) Merge(other *Stats) {
+	s.Raw.Add(other.Raw.Load())
+	s.Sent.Add(other.Sent.Load())
+	s.Skipped.Add(other.Skipped.Load())
+}
+
+// Ratio returns sent / raw, 1 for nothing written.
+func (s *Stats) Ratio() float64 {
+	raw := s.Raw.Load()
+	if raw == 0 {
+		return 1
+	}
+
+	return float64(s.Sent.Load()) / float64(raw)
+}
+
+func (s *Stats) String() string {
+	return fmt.Sprintf(
+		"raw: %d, sent: %d, ratio: %.1f%%, skipped frames: %d",
+		s.Raw.Load(),
+		s.Sent.Load(),
+		s.Ratio()*100,
+		s.Skipped.Load(),
+	)
+}
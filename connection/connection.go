@@ -1,10 +1,20 @@
 package connection
 
 import (
+	"hash/fnv"
 	"io"
 	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-zoox/gzfly/compression"
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/protocol/closewrite"
+	"github.com/go-zoox/gzfly/protocol/window"
+	"github.com/go-zoox/gzfly/scheduler"
 	"github.com/go-zoox/logger"
 	"github.com/go-zoox/packet/socksz"
 	"github.com/go-zoox/packet/socksz/base"
@@ -23,19 +33,65 @@ func NewWSClient(client *websocket.Client) *WSClient {
 	}
 }
 
+// LinkIndex returns the index of link used by connection among n links,
+// the same id always gets the same link while n is unchanged.
+func LinkIndex(id string, n int) int {
+	if n <= 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(n))
+}
+
 type WSConn struct {
 	ID     string
 	Client *WSClient
 	// ch
-	Stream      chan []byte
 	HandshakeCh chan bool
 	//
 	OnClose func()
 	//
 	Crypto uint8
 	Secret string
+	// Priority is the class of the connection in the send scheduler
+	Priority scheduler.Class
+	// CompressionStats counts the bytes written before and after compression
+	CompressionStats compression.Stats
+	// compression is the algorithm to compress written data with, accepted by peer
+	compression atomic.Uint32
+	//
+	local, remote *Addr
+	// readMu and writeMu keep concurrent reads and writes whole
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+	// pending is the rest of the last frame not yet read
+	pending []byte
+	// chunks are delivered but not yet read, readable is notified on delivery
+	mu       sync.Mutex
+	chunks   [][]byte
+	readable chan struct{}
+	//
+	readDeadline  *deadline
+	writeDeadline *deadline
+	// closed is fired by Close, gone once peer closes the connection, done once either of them,
+	// eof once peer closes the connection or its writing side, writeClosed by CloseWrite
+	closed      *event
+	gone        *event
+	done        *event
+	eof         *event
+	writeClosed *event
+	onCloseOnce sync.Once
+	// reason is why peer aborted the connection, see Abort
+	reason error
+	// halfClose and datagram are the options of peer, known once optionsKnown is fired
+	halfClose    atomic.Bool
+	datagram     atomic.Bool
+	optionsKnown *event
 	//
-	isClosed bool
+	sendWindow *sendWindow
+	recvWindow *recvWindow
 }
 
 type ConnectionOptions struct {
@@ -43,12 +99,17 @@ type ConnectionOptions struct {
 	//
 	Crypto uint8
 	Secret string
+	//
+	LocalAddr  *Addr
+	RemoteAddr *Addr
 }
 
 func New(client *WSClient, opts ...*ConnectionOptions) *WSConn {
 	id := ""
 	crypto := uint8(0x00)
 	secret := ""
+	local := &Addr{}
+	remote := &Addr{}
 	if len(opts) > 0 && opts[0] != nil {
 		if opts[0].ID != "" {
 			id = opts[0].ID
@@ -61,43 +122,221 @@ func New(client *WSClient, opts ...*ConnectionOptions) *WSConn {
 		if opts[0].Secret != "" {
 			secret = opts[0].Secret
 		}
+
+		if opts[0].LocalAddr != nil {
+			*local = *opts[0].LocalAddr
+		}
+
+		if opts[0].RemoteAddr != nil {
+			*remote = *opts[0].RemoteAddr
+		}
 	}
 
 	if id == "" {
 		id = socksz.GenerateID()
 	}
+	local.ID = id
+	remote.ID = id
 
 	return &WSConn{
 		ID:          id,
 		Client:      client,
-		Stream:      make(chan []byte),
-		HandshakeCh: make(chan bool),
+		HandshakeCh: make(chan bool, 1),
 		//
 		Crypto: crypto,
 		Secret: secret,
+		//
+		local:  local,
+		remote: remote,
+		//
+		readable: make(chan struct{}, 1),
+		//
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+		//
+		closed:      newEvent(),
+		gone:        newEvent(),
+		done:        newEvent(),
+		eof:         newEvent(),
+		writeClosed: newEvent(),
+		//
+		optionsKnown: newEvent(),
+		//
+		sendWindow: newSendWindow(),
+		recvWindow: &recvWindow{size: DefaultWindow},
 	}
 }
 
-func (wc *WSConn) Read(b []byte) (n int, err error) {
-	if wc.isClosed {
-		return 0, io.EOF
+// OpenWindow starts flow control with the receive window of peer,
+// consumed bytes are returned to peer by window updates from now on.
+// confirmed means peer has proved it sends window updates, so sending is
+// limited at once and an update is sent back as the confirmation;
+// otherwise sending is limited since the first window update from peer.
+func (wc *WSConn) OpenWindow(peer uint32, confirmed bool) error {
+	wc.sendWindow.add(peer, confirmed)
+
+	increment := wc.recvWindow.open()
+	if !confirmed && increment == 0 {
+		return nil
 	}
 
+	return wc.writeWindowUpdate(increment)
+}
+
+// UpdateWindow adds the credit returned by peer, sending is limited since the first one,
+// which is told to peer by an update with the bytes sent before.
+func (wc *WSConn) UpdateWindow(increment uint32) {
+	if !wc.sendWindow.add(increment, true) {
+		return
+	}
+
+	if err := wc.writeWindowUpdate(0); err != nil {
+		logger.Warnf("[connection][window][connection: %s] failed to tell peer sending is limited: %v", wc.ID, err)
+	}
+}
+
+// PeerLimited marks peer limiting its sending by our window after sent bytes,
+// data beyond it fails Deliver from now on.
+func (wc *WSConn) PeerLimited(sent uint64) {
+	wc.recvWindow.limitPeer(int64(sent))
+}
+
+func (wc *WSConn) writeWindowUpdate(increment uint32) error {
+	dataPacket := &window.Update{
+		ConnectionID: wc.ID,
+		Increment:    increment,
+	}
+	// peer checks our sending from now on
+	if sentBefore, limited := wc.sendWindow.limited(); limited {
+		dataPacket.Limited = true
+		dataPacket.Sent = uint64(sentBefore)
+	}
+	data, err := dataPacket.Encode()
+	if err != nil {
+		return err
+	}
+
+	packet := &base.Base{
+		Ver:  socksz.VER,
+		Cmd:  protocol.CommandWindowUpdate,
+		Data: data,
+		//
+		Crypto: wc.Crypto,
+	}
+	bytes, err := packet.Encode()
+	if err != nil {
+		return err
+	}
+
+	return wc.Client.WriteBinary(bytes)
+}
+
+// Read reads data received from peer, which is still readable after peer
+// closes the connection, then it returns io.EOF.
+func (wc *WSConn) Read(b []byte) (n int, err error) {
+	wc.readMu.Lock()
+	defer wc.readMu.Unlock()
+
 	logger.Debugf("[connection][read][connection: %s] start to read ...", wc.ID)
 
-	// data := <-wc.Stream
-	// n = copy(b, data[ID_LENGTH:])
-	n = copy(b, <-wc.Stream)
+	if wc.closed.happened() {
+		return 0, net.ErrClosed
+	}
+	if isDone(wc.readDeadline.wait()) {
+		return 0, os.ErrDeadlineExceeded
+	}
+
+	if len(wc.pending) == 0 {
+		if wc.pending, err = wc.next(); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(b, wc.pending)
+	wc.pending = wc.pending[n:]
+
+	if increment := wc.recvWindow.consume(n); increment != 0 {
+		if err := wc.writeWindowUpdate(increment); err != nil {
+			logger.Warnf("[connection][read][connection: %s] failed to update window: %v", wc.ID, err)
+		}
+	}
 
 	logger.Debugf("[connection][read][connection: %s] succeed to read: %d", wc.ID, n)
 	return
 }
 
+// Write writes b to peer in frames of at most MaxFrameSize,
+// it waits for the window of peer if flow control is enabled.
 func (wc *WSConn) Write(b []byte) (n int, err error) {
-	if wc.isClosed {
-		return 0, io.EOF
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+
+	if err := wc.writeError(); err != nil {
+		return 0, err
+	}
+
+	for n < len(b) {
+		size := len(b) - n
+		if size > MaxFrameSize {
+			size = MaxFrameSize
+		}
+
+		size, ok := wc.sendWindow.acquire(size, wc.writeDeadline.wait(), wc.done.wait())
+		if !ok {
+			return n, wc.writeError()
+		}
+
+		if _, err := wc.write(b[n : n+size]); err != nil {
+			// not sent, give the credit back
+			wc.sendWindow.release(size)
+
+			if errx := wc.writeError(); errx != nil {
+				return n, errx
+			}
+			return n, err
+		}
+		n += size
 	}
 
+	return n, nil
+}
+
+// writeError returns why writes fail now, nil if writable.
+func (wc *WSConn) writeError() error {
+	switch {
+	case wc.closed.happened():
+		return net.ErrClosed
+	case wc.gone.happened():
+		return wc.abortReason(io.ErrClosedPipe)
+	case wc.writeClosed.happened():
+		return io.ErrClosedPipe
+	case isDone(wc.writeDeadline.wait()):
+		return os.ErrDeadlineExceeded
+	default:
+		return nil
+	}
+}
+
+// WriteCancel returns the channels closed once a pending write should give up,
+// that is the write deadline is reached or the connection is done.
+func (wc *WSConn) WriteCancel() []<-chan struct{} {
+	return []<-chan struct{}{wc.writeDeadline.wait(), wc.done.wait()}
+}
+
+// SetCompression sets the algorithm to compress written data with.
+func (wc *WSConn) SetCompression(algorithm uint8) {
+	wc.compression.Store(uint32(algorithm))
+}
+
+// Compression returns the algorithm to compress written data with.
+func (wc *WSConn) Compression() uint8 {
+	return uint8(wc.compression.Load())
+}
+
+// write sends b to peer in one forward frame, compressed before encryption.
+func (wc *WSConn) write(b []byte) (n int, err error) {
+	algorithm, compressed := compression.Compress(wc.Compression(), b)
+	wc.CompressionStats.Add(len(b), len(compressed), algorithm != compression.None)
+
 	// data, err := EncodeID(wc.ID)
 	// if err != nil {
 	// 	return 0, err
@@ -115,7 +354,7 @@ func (wc *WSConn) Write(b []byte) (n int, err error) {
 		Secret: wc.Secret,
 		//
 		ConnectionID: wc.ID,
-		Data:         b,
+		Data:         compressed,
 	}
 	data, err := dataPacket.Encode()
 	if err != nil {
@@ -127,7 +366,8 @@ func (wc *WSConn) Write(b []byte) (n int, err error) {
 		Cmd:  socksz.CommandForward,
 		Data: data,
 		//
-		Crypto: wc.Crypto,
+		Crypto:      wc.Crypto,
+		Compression: algorithm,
 	}
 	bytes, err := packet.Encode()
 	if err != nil {
@@ -150,9 +390,16 @@ func (wc *WSConn) Write(b []byte) (n int, err error) {
 	return len(b), nil
 }
 
+// Close closes the connection and notifies peer,
+// pending reads and writes are unblocked with net.ErrClosed.
 func (wc *WSConn) Close() error {
-	// closed
-	if wc.isClosed {
+	if !wc.closed.fire() {
+		return nil
+	}
+	wc.finish()
+
+	// peer is gone already
+	if wc.gone.happened() {
 		return nil
 	}
 
@@ -176,33 +423,202 @@ func (wc *WSConn) Close() error {
 		return err
 	}
 
-	if wc.OnClose != nil {
-		wc.OnClose()
+	return wc.Client.WriteBinary(bytes)
+}
+
+// Disconnect marks the connection closed by peer, nothing is sent back.
+// Data received is still readable, then Read returns io.EOF,
+// and Write returns io.ErrClosedPipe.
+func (wc *WSConn) Disconnect() {
+	wc.gone.fire()
+	wc.eof.fire()
+	wc.finish()
+}
+
+// Abort marks the connection closed by peer for reason, such as the target failed to connect,
+// Read and Write return reason instead of io.EOF and io.ErrClosedPipe.
+func (wc *WSConn) Abort(reason error) {
+	wc.mu.Lock()
+	if wc.reason == nil {
+		wc.reason = reason
+	}
+	wc.mu.Unlock()
+
+	wc.Disconnect()
+}
+
+// abortReason returns the reason of Abort, or err if not aborted.
+func (wc *WSConn) abortReason(err error) error {
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+
+	if wc.reason != nil {
+		return wc.reason
 	}
 
-	wc.isClosed = true
+	return err
+}
+
+// OptionsTimeout is how long to wait to know the options of peer,
+// which are unsupported if not known by then.
+const OptionsTimeout = 3 * time.Second
+
+// SetHalfClose tells whether peer supports half-close, CloseWrite waits for it.
+// The options of peer are known after it.
+func (wc *WSConn) SetHalfClose(supported bool) {
+	if supported {
+		wc.halfClose.Store(true)
+	}
+	wc.optionsKnown.fire()
+}
+
+// SetDatagram tells whether peer frames datagrams, called before SetHalfClose.
+func (wc *WSConn) SetDatagram(supported bool) {
+	if supported {
+		wc.datagram.Store(true)
+	}
+}
+
+// Datagram reports whether peer frames datagrams, waiting for the options of peer.
+func (wc *WSConn) Datagram() bool {
+	wc.waitOptions()
+
+	return wc.datagram.Load()
+}
+
+func (wc *WSConn) waitOptions() {
+	select {
+	case <-wc.optionsKnown.wait():
+	case <-wc.done.wait():
+	case <-time.After(OptionsTimeout):
+	}
+}
+
+// CloseWrite shuts down the writing side, peer reads io.EOF after the data
+// written before, while data from peer is still readable.
+// The connection is closed instead if peer does not support half-close.
+func (wc *WSConn) CloseWrite() error {
+	wc.waitOptions()
+
+	if !wc.halfClose.Load() {
+		return wc.Close()
+	}
+
+	// after the data being written
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+
+	if err := wc.writeError(); err != nil {
+		return err
+	}
+	wc.writeClosed.fire()
+
+	dataPacket := &closewrite.CloseWrite{
+		ConnectionID: wc.ID,
+	}
+	data, err := dataPacket.Encode()
+	if err != nil {
+		return err
+	}
+
+	packet := &base.Base{
+		Ver:  socksz.VER,
+		Cmd:  protocol.CommandCloseWrite,
+		Data: data,
+		//
+		Crypto: wc.Crypto,
+	}
+	bytes, err := packet.Encode()
+	if err != nil {
+		return err
+	}
 
 	return wc.Client.WriteBinary(bytes)
 }
 
+// PeerCloseWrite marks the writing side of peer shut down,
+// Read returns io.EOF once data received is read.
+func (wc *WSConn) PeerCloseWrite() {
+	wc.eof.fire()
+}
+
+// finish marks the connection done, OnClose is called once.
+func (wc *WSConn) finish() {
+	wc.done.fire()
+
+	wc.onCloseOnce.Do(func() {
+		if wc.OnClose != nil {
+			wc.OnClose()
+		}
+	})
+}
+
 func (wc *WSConn) LocalAddr() net.Addr {
-	// return wc.Client.LocalAddr()
-	return nil
+	return wc.local
 }
 
 func (wc *WSConn) RemoteAddr() net.Addr {
-	// return wc.Client.RemoteAddr()
-	return nil
+	return wc.remote
+}
+
+// Addr is the address of one end of a connection over gzfly,
+// servers such as net/http require it to be non-nil.
+type Addr struct {
+	// ID is the connection id
+	ID string
+	// ClientID is the user client id of the end, empty if unknown
+	ClientID string
+	// Host and Port are the destination, dialed by the end of target
+	Host string
+	Port int
+}
+
+// Network returns the name of the network.
+func (a *Addr) Network() string {
+	return "gzfly"
+}
+
+// String returns client_id/host:port, or parts of it known,
+// the connection id if nothing is known.
+func (a *Addr) String() string {
+	s := a.ClientID
+	if a.Host != "" {
+		if s != "" {
+			s += "/"
+		}
+		s += net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+	}
+
+	if s == "" {
+		return a.ID
+	}
+	return s
 }
 
 func (wc *WSConn) SetDeadline(t time.Time) error {
+	if wc.closed.happened() {
+		return net.ErrClosed
+	}
+
+	wc.readDeadline.set(t)
+	wc.writeDeadline.set(t)
 	return nil
 }
 
 func (wc *WSConn) SetReadDeadline(t time.Time) error {
+	if wc.closed.happened() {
+		return net.ErrClosed
+	}
+
+	wc.readDeadline.set(t)
 	return nil
 }
 
 func (wc *WSConn) SetWriteDeadline(t time.Time) error {
+	if wc.closed.happened() {
+		return net.ErrClosed
+	}
+
+	wc.writeDeadline.set(t)
 	return nil
 }
@@ -0,0 +1,76 @@
+package connection
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/nettest"
+)
+
+func TestConn(t *testing.T) {
+	nettest.TestConn(t, func() (net.Conn, net.Conn, func(), error) {
+		source, target := newPipe(t)
+
+		stop := func() {
+			source.Close()
+			target.Close()
+		}
+
+		return source, target, stop, nil
+	})
+}
+
+func TestConnAddr(t *testing.T) {
+	source, target := newPipe(t)
+
+	if got, want := source.LocalAddr().String(), target.RemoteAddr().String(); got != want {
+		t.Errorf("source local %s, target remote %s", got, want)
+	}
+
+	if got, want := source.RemoteAddr().String(), target.LocalAddr().String(); got != want {
+		t.Errorf("source remote %s, target local %s", got, want)
+	}
+
+	if network := source.LocalAddr().Network(); network == "" {
+		t.Error("empty network of address")
+	}
+}
+
+func TestConnPartialRead(t *testing.T) {
+	source, target := newPipe(t)
+
+	// one frame, read in parts smaller than it
+	if _, err := source.Write([]byte("hello, world")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := ""
+	buf := make([]byte, 5)
+	for len(got) < len("hello, world") {
+		n, err := target.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got += string(buf[:n])
+	}
+
+	if got != "hello, world" {
+		t.Fatalf("read %q", got)
+	}
+}
+
+func TestConnDatagram(t *testing.T) {
+	source, target := connectPipe(t, nil)
+
+	// the target knows from the handshake request, the source from settings
+	target.SetDatagram(true)
+	target.SetHalfClose(true)
+	source.SetHalfClose(true)
+
+	if !target.Datagram() {
+		t.Error("expect target to frame datagrams")
+	}
+	if source.Datagram() {
+		t.Error("expect source not to frame datagrams without the option")
+	}
+}
@@ -0,0 +1,74 @@
+package connection
+
+import (
+	"sync"
+	"time"
+)
+
+// deadline is a channel closed once the time is reached,
+// waits select on it to give up with os.ErrDeadlineExceeded.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{
+		cancel: make(chan struct{}),
+	}
+}
+
+// set sets the deadline, zero t means no deadline.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		// the timer is closing cancel
+		<-d.cancel
+	}
+	d.timer = nil
+
+	expired := isDone(d.cancel)
+	if t.IsZero() {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if duration := time.Until(t); duration > 0 {
+		if expired {
+			d.cancel = make(chan struct{})
+		}
+
+		cancel := d.cancel
+		d.timer = time.AfterFunc(duration, func() {
+			close(cancel)
+		})
+		return
+	}
+
+	// past deadline
+	if !expired {
+		close(d.cancel)
+	}
+}
+
+// wait returns the channel closed once the deadline is reached.
+func (d *deadline) wait() chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.cancel
+}
+
+func isDone(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,35 @@
+package connection
+
+import "sync"
+
+// event is a channel closed once it happens.
+type event struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newEvent() *event {
+	return &event{
+		ch: make(chan struct{}),
+	}
+}
+
+// fire makes the event happen, true for the first time.
+func (e *event) fire() bool {
+	fired := false
+	e.once.Do(func() {
+		close(e.ch)
+		fired = true
+	})
+	return fired
+}
+
+// wait returns the channel closed once the event happens.
+func (e *event) wait() <-chan struct{} {
+	return e.ch
+}
+
+// happened returns whether the event happened.
+func (e *event) happened() bool {
+	return isDone(e.ch)
+}
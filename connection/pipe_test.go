@@ -0,0 +1,188 @@
+package connection
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/protocol/closewrite"
+	"github.com/go-zoox/gzfly/protocol/window"
+	"github.com/go-zoox/packet/socksz"
+	"github.com/go-zoox/packet/socksz/base"
+	"github.com/go-zoox/packet/socksz/forward"
+	"github.com/go-zoox/zoox/components/application/websocket"
+)
+
+// frames is an unbounded queue of frames, handled in order by one goroutine like a link.
+type frames struct {
+	sync.Mutex
+	cond   *sync.Cond
+	frames [][]byte
+	closed bool
+}
+
+func newFrames() *frames {
+	f := &frames{}
+	f.cond = sync.NewCond(&f.Mutex)
+	return f
+}
+
+func (f *frames) push(frame []byte) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.frames = append(f.frames, append([]byte{}, frame...))
+	f.cond.Signal()
+}
+
+func (f *frames) pop() ([]byte, bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	for len(f.frames) == 0 && !f.closed {
+		f.cond.Wait()
+	}
+	if len(f.frames) == 0 {
+		return nil, false
+	}
+
+	frame := f.frames[0]
+	f.frames = f.frames[1:]
+	return frame, true
+}
+
+func (f *frames) close() {
+	f.Lock()
+	defer f.Unlock()
+
+	f.closed = true
+	f.cond.Broadcast()
+}
+
+// newPipe returns both ends of one tunneled connection, frames written by one
+// are handled by the other as the client does, with flow control and half-close.
+func newPipe(t testing.TB) (*WSConn, *WSConn) {
+	source, target := connectPipe(t, nil)
+
+	// as the handshake request with options and the settings back
+	target.SetHalfClose(true)
+	if err := target.OpenWindow(DefaultWindow, false); err != nil {
+		t.Fatal(err)
+	}
+	source.SetHalfClose(true)
+	if err := source.OpenWindow(DefaultWindow, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// both ends limit sending once the updates are through, as settings come before data
+	deadline := time.Now().Add(3 * time.Second)
+	for !peerLimited(source) || !peerLimited(target) {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for both ends to limit sending")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return source, target
+}
+
+func peerLimited(wc *WSConn) bool {
+	wc.recvWindow.Lock()
+	defer wc.recvWindow.Unlock()
+
+	return wc.recvWindow.peerLimited
+}
+
+// connectPipe returns both ends without options exchanged yet,
+// onFrame, if not nil, sees the frames to target and drops the ones it returns false.
+func connectPipe(t testing.TB, onFrame func(packet *base.Base) bool) (*WSConn, *WSConn) {
+	id := socksz.GenerateID()
+	source := New(&WSClient{Client: &websocket.Client{}}, &ConnectionOptions{
+		ID:         id,
+		LocalAddr:  &Addr{ClientID: "source", Host: "127.0.0.1", Port: 10001},
+		RemoteAddr: &Addr{ClientID: "target", Host: "127.0.0.1", Port: 80},
+	})
+	target := New(&WSClient{Client: &websocket.Client{}}, &ConnectionOptions{
+		ID:         id,
+		LocalAddr:  &Addr{ClientID: "target", Host: "127.0.0.1", Port: 80},
+		RemoteAddr: &Addr{ClientID: "source", Host: "127.0.0.1", Port: 10001},
+	})
+
+	connect := func(from, to *WSConn, filter func(packet *base.Base) bool) {
+		queue := newFrames()
+		from.Client.WriteBinaryHandler = func(bytes []byte) error {
+			queue.push(bytes)
+			return nil
+		}
+		t.Cleanup(queue.close)
+
+		go func() {
+			for {
+				frame, ok := queue.pop()
+				if !ok {
+					return
+				}
+
+				packet := &base.Base{}
+				if err := packet.Decode(frame); err != nil {
+					t.Errorf("invalid frame: %v", err)
+					return
+				}
+
+				if filter != nil && !filter(packet) {
+					continue
+				}
+
+				handleFrame(t, to, packet)
+			}
+		}()
+	}
+	connect(source, target, onFrame)
+	connect(target, source, nil)
+
+	t.Cleanup(func() {
+		source.Close()
+		target.Close()
+	})
+
+	return source, target
+}
+
+func handleFrame(t testing.TB, conn *WSConn, packet *base.Base) {
+	switch packet.Cmd {
+	case socksz.CommandForward:
+		forwardPacket := &forward.Forward{}
+		if err := forwardPacket.Decode(packet.Data); err != nil {
+			t.Errorf("invalid forward: %v", err)
+			return
+		}
+
+		if err := conn.Receive(packet.Compression, forwardPacket.Data); err != nil {
+			conn.Close()
+		}
+	case socksz.CommandClose:
+		conn.Disconnect()
+	case protocol.CommandCloseWrite:
+		closeWritePacket := &closewrite.CloseWrite{}
+		if err := closeWritePacket.Decode(packet.Data); err != nil {
+			t.Errorf("invalid close write: %v", err)
+			return
+		}
+
+		conn.PeerCloseWrite()
+	case protocol.CommandWindowUpdate:
+		windowPacket := &window.Update{}
+		if err := windowPacket.Decode(packet.Data); err != nil {
+			t.Errorf("invalid window update: %v", err)
+			return
+		}
+
+		if windowPacket.Limited {
+			conn.PeerLimited(windowPacket.Sent)
+		}
+		conn.UpdateWindow(windowPacket.Increment)
+	default:
+		t.Errorf("unexpected frame(cmd: %d)", packet.Cmd)
+	}
+}
@@ -0,0 +1,81 @@
+package connection
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/go-zoox/gzfly/compression"
+)
+
+// Deliver queues data received from peer for Read, it never blocks,
+// so a slow reader does not hold up other connections on the link.
+// It fails if peer sends beyond the receive window, or beyond MaxBuffered
+// if peer does not limit sending, then the data not read yet is dropped,
+// the caller should close the connection.
+func (wc *WSConn) Deliver(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := wc.recvWindow.receive(len(data)); err != nil {
+		wc.mu.Lock()
+		wc.chunks = nil
+		wc.mu.Unlock()
+		return err
+	}
+
+	wc.mu.Lock()
+	wc.chunks = append(wc.chunks, data)
+	wc.mu.Unlock()
+
+	select {
+	case wc.readable <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Receive decompresses the data of a forward frame and delivers it.
+func (wc *WSConn) Receive(algorithm uint8, data []byte) error {
+	data, err := compression.Decompress(algorithm, data)
+	if err != nil {
+		return fmt.Errorf("failed to decompress(%s): %v", compression.Name(algorithm), err)
+	}
+
+	return wc.Deliver(data)
+}
+
+// next waits for the next delivered chunk,
+// chunks delivered before peer closes are still readable.
+func (wc *WSConn) next() ([]byte, error) {
+	for {
+		wc.mu.Lock()
+		if len(wc.chunks) != 0 {
+			chunk := wc.chunks[0]
+			wc.chunks[0] = nil
+			wc.chunks = wc.chunks[1:]
+			wc.mu.Unlock()
+			return chunk, nil
+		}
+		wc.mu.Unlock()
+
+		select {
+		case <-wc.readable:
+		case <-wc.closed.wait():
+			return nil, net.ErrClosed
+		case <-wc.readDeadline.wait():
+			return nil, os.ErrDeadlineExceeded
+		case <-wc.eof.wait():
+			// chunks may be delivered just before eof
+			wc.mu.Lock()
+			empty := len(wc.chunks) == 0
+			wc.mu.Unlock()
+			if empty {
+				return nil, wc.abortReason(io.EOF)
+			}
+		}
+	}
+}
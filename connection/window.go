@@ -0,0 +1,194 @@
+package connection
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DefaultWindow is the receive window advertised for each connection,
+// a slow reader only holds up its own connection once it is full.
+const DefaultWindow = 1 << 20
+
+// MaxBuffered is the max bytes not read yet of a connection whose peer does not limit sending,
+// such as older peers, or before the window is enforced, the connection is closed beyond it.
+const MaxBuffered = 4 * DefaultWindow
+
+// MaxFrameSize is the max data size of a forward frame.
+const MaxFrameSize = 32 << 10
+
+// sendWindow limits the bytes in flight to peer,
+// credits come back by window updates once peer consumes the data.
+type sendWindow struct {
+	sync.Mutex
+	// credit may go negative while not enforced, it is what peer still accepts
+	credit   int64
+	enforced bool
+	// sent is the bytes taken, sentBefore is the bytes taken before enforced,
+	// which peer accepts beyond its window
+	sent       int64
+	sentBefore int64
+	// changed is closed and renewed once credit is added
+	changed chan struct{}
+}
+
+func newSendWindow() *sendWindow {
+	return &sendWindow{
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire waits for credit and takes up to n bytes of it,
+// false once deadline is reached or the connection is done.
+func (w *sendWindow) acquire(n int, deadline, done <-chan struct{}) (int, bool) {
+	for {
+		w.Lock()
+		if !w.enforced || w.credit > 0 {
+			if w.enforced && int64(n) > w.credit {
+				n = int(w.credit)
+			}
+			w.credit -= int64(n)
+			w.sent += int64(n)
+			w.Unlock()
+			return n, true
+		}
+		changed := w.changed
+		w.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return 0, false
+		case <-done:
+			return 0, false
+		}
+	}
+}
+
+// add adds n bytes of credit, enforce starts limiting sending,
+// it returns true if sending is limited from now on.
+func (w *sendWindow) add(n uint32, enforce bool) bool {
+	w.Lock()
+	defer w.Unlock()
+
+	w.credit += int64(n)
+	started := enforce && !w.enforced
+	if started {
+		w.enforced = true
+		w.sentBefore = w.sent
+	}
+
+	w.notify()
+	return started
+}
+
+// release gives back n bytes taken but not sent.
+func (w *sendWindow) release(n int) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.credit += int64(n)
+	w.sent -= int64(n)
+	w.notify()
+}
+
+// limited returns the bytes sent before limiting, false if not limited yet.
+func (w *sendWindow) limited() (int64, bool) {
+	w.Lock()
+	defer w.Unlock()
+
+	return w.sentBefore, w.enforced
+}
+
+func (w *sendWindow) notify() {
+	close(w.changed)
+	w.changed = make(chan struct{})
+}
+
+// recvWindow counts the bytes consumed by reader,
+// they are returned to peer once over half of the window.
+//
+// Once peer limits its sending (see sendWindow), it never sends more than
+// the window beyond the credit returned, or than it sent before limiting.
+type recvWindow struct {
+	sync.Mutex
+	size     uint32
+	consumed uint32
+	opened   bool
+	// received is the bytes delivered, read is the bytes consumed,
+	// returned is the credit returned to peer
+	received int64
+	read     int64
+	returned int64
+	// peerLimited is whether peer limits sending, after peerSentBefore bytes
+	peerLimited    bool
+	peerSentBefore int64
+}
+
+// consume returns the increment to send to peer, 0 for nothing.
+func (w *recvWindow) consume(n int) uint32 {
+	w.Lock()
+	defer w.Unlock()
+
+	w.consumed += uint32(n)
+	w.read += int64(n)
+	if !w.opened || w.consumed < w.size/2 {
+		return 0
+	}
+
+	increment := w.consumed
+	w.consumed = 0
+	w.returned += int64(increment)
+	return increment
+}
+
+// open starts returning consumed bytes, returns the bytes consumed so far.
+func (w *recvWindow) open() uint32 {
+	w.Lock()
+	defer w.Unlock()
+
+	w.opened = true
+	increment := w.consumed
+	w.consumed = 0
+	w.returned += int64(increment)
+	return increment
+}
+
+// receive counts n bytes delivered, it fails if peer sends beyond the window,
+// or beyond MaxBuffered not read yet while peer does not limit sending.
+func (w *recvWindow) receive(n int) error {
+	w.Lock()
+	defer w.Unlock()
+
+	w.received += int64(n)
+	if !w.peerLimited {
+		if buffered := w.received - w.read; buffered > MaxBuffered {
+			return fmt.Errorf("peer does not limit sending, %d bytes buffered while %d are allowed", buffered, MaxBuffered)
+		}
+
+		return nil
+	}
+
+	allowed := int64(w.size) + w.returned
+	if w.peerSentBefore > allowed {
+		allowed = w.peerSentBefore
+	}
+
+	if w.received > allowed {
+		return fmt.Errorf("flow control violated, received %d bytes while %d are allowed", w.received, allowed)
+	}
+
+	return nil
+}
+
+// limitPeer marks peer limiting sending by the window, after sentBefore bytes.
+func (w *recvWindow) limitPeer(sentBefore int64) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.peerLimited {
+		return
+	}
+
+	w.peerLimited = true
+	w.peerSentBefore = sentBefore
+}
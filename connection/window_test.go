@@ -0,0 +1,179 @@
+package connection
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/packet/socksz"
+	"github.com/go-zoox/packet/socksz/base"
+)
+
+func TestWindowSlowReader(t *testing.T) {
+	source, target := newPipe(t)
+
+	data := make([]byte, 4*DefaultWindow)
+	rand.Read(data)
+
+	go func() {
+		if _, err := source.Write(data); err != nil {
+			t.Errorf("write: %v", err)
+		}
+		source.CloseWrite()
+	}()
+
+	got := bytes.NewBuffer(nil)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := target.Read(buf)
+		got.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+
+		// slower than the writer, which waits for the window
+		if got.Len()%(DefaultWindow/2) < len(buf) {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Fatalf("read %d bytes, not the %d written", got.Len(), len(data))
+	}
+}
+
+func TestWindowSentBeforeLimited(t *testing.T) {
+	source, target := connectPipe(t, nil)
+	target.SetHalfClose(true)
+	if err := target.OpenWindow(DefaultWindow, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// written before the settings of target come, not limited yet
+	data := make([]byte, 3*DefaultWindow)
+	rand.Read(data)
+	if _, err := source.Write(data[:2*DefaultWindow]); err != nil {
+		t.Fatal(err)
+	}
+
+	source.SetHalfClose(true)
+	if err := source.OpenWindow(DefaultWindow, true); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := source.Write(data[2*DefaultWindow:]); err != nil {
+			t.Errorf("write: %v", err)
+		}
+		source.CloseWrite()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	got, err := io.ReadAll(target)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatalf("read %d bytes, not the %d written", len(got), len(data))
+	}
+}
+
+func TestWindowViolation(t *testing.T) {
+	limited := make(chan struct{})
+	source, target := connectPipe(t, func(packet *base.Base) bool {
+		if packet.Cmd != socksz.CommandForward {
+			select {
+			case <-limited:
+			default:
+				close(limited)
+			}
+		}
+		return true
+	})
+	target.SetHalfClose(true)
+	if err := target.OpenWindow(DefaultWindow, false); err != nil {
+		t.Fatal(err)
+	}
+	source.SetHalfClose(true)
+	if err := source.OpenWindow(DefaultWindow, true); err != nil {
+		t.Fatal(err)
+	}
+	<-limited
+
+	// a peer ignoring credits, frames are written without the window
+	chunk := make([]byte, MaxFrameSize)
+	for sent := 0; sent <= DefaultWindow; sent += len(chunk) {
+		if _, err := source.write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case <-source.gone.wait():
+	case <-time.After(3 * time.Second):
+		t.Fatal("peer ignoring the window is not closed")
+	}
+
+	if _, err := target.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("read after violation: %v, want net.ErrClosed", err)
+	}
+
+	if _, err := source.Write(chunk); err == nil {
+		t.Fatal("write of closed peer succeeds")
+	}
+}
+
+func TestRecvWindow(t *testing.T) {
+	w := &recvWindow{size: 100}
+	w.open()
+
+	// not checked until peer limits sending
+	if err := w.receive(300); err != nil {
+		t.Fatal(err)
+	}
+
+	w.limitPeer(300)
+	if err := w.receive(0); err != nil {
+		t.Fatalf("bytes sent before limiting: %v", err)
+	}
+
+	// consumed bytes are returned once over half of the window
+	if increment := w.consume(300); increment != 300 {
+		t.Fatalf("increment: %d, want 300", increment)
+	}
+	if err := w.receive(100); err != nil {
+		t.Fatalf("within the window: %v", err)
+	}
+	if err := w.receive(1); err == nil {
+		t.Fatal("beyond the window, want error")
+	}
+}
+
+func TestRecvWindowPeerNotLimited(t *testing.T) {
+	w := &recvWindow{size: 100}
+
+	// peers not limiting sending, such as older ones, are bounded by the bytes not read yet
+	if err := w.receive(MaxBuffered); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.receive(1); err == nil {
+		t.Fatal("beyond the buffer, want error")
+	}
+
+	w = &recvWindow{size: 100}
+	if err := w.receive(MaxBuffered); err != nil {
+		t.Fatal(err)
+	}
+	w.consume(100)
+	if err := w.receive(100); err != nil {
+		t.Fatalf("within the buffer once read: %v", err)
+	}
+}
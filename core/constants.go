@@ -18,4 +18,11 @@ const (
 	STATUS_FAILED_TO_PAIR             = 0x04
 	STATUS_FAILED_TO_HANDSHAKE        = 0x05
 	STATUS_FAILED_TO_SET_USER_ONELINE = 0x06
+	STATUS_FAILED_TO_LISTEN           = 0x07
+	STATUS_FAILED_TO_CONNECT          = 0x08
+	STATUS_P2P_DISABLED               = 0x09
+	STATUS_TARGET_NOT_ALLOWED         = 0x0A
+	STATUS_TOKEN_EXPIRED              = 0x0B
+	STATUS_LISTEN_NOT_ALLOWED         = 0x0C
+	STATUS_CRYPTO_NOT_ALLOWED         = 0x0D
 )
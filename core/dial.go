@@ -0,0 +1,82 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/go-zoox/gzfly/network/udp"
+	"github.com/go-zoox/logger"
+	"github.com/go-zoox/packet/socksz/handshake"
+	"golang.org/x/net/proxy"
+)
+
+// Dial connects to the address on the named network through the target peer,
+// the returned connection behaves like the one from net.Dial.
+//
+// Known networks are "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6", "unix"
+// and the ones from network.Register, the address of unix is the socket path on the target.
+func (c *client) Dial(ctx context.Context, target *Target, network, address string) (net.Conn, error) {
+	name := network
+	switch network {
+	case "tcp4", "tcp6":
+		name = "tcp"
+	case "udp4", "udp6":
+		name = "udp"
+	}
+
+	Network, err := getNetwork(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// addresses of other networks are passed as is, such as socket paths
+	host, port := address, 0
+	if name == "tcp" || name == "udp" {
+		host, port, err = splitHostPort(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address(%s): %v", address, err)
+		}
+	}
+
+	logger.Infof("[dial] request %s://%s", network, address)
+
+	wsConn, err := c.open(ctx, target, Network, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	// each write is one datagram, like the conn of net.Dial
+	if Network == handshake.NetworkUDP {
+		return udp.NewDatagramConn(wsConn), nil
+	}
+
+	return wsConn, nil
+}
+
+// Dialer dials through a peer, it satisfies proxy.Dialer and proxy.ContextDialer,
+// so its DialContext can be used as http.Transport.DialContext or a grpc context dialer.
+type Dialer struct {
+	Client Client
+	Target *Target
+}
+
+var _ proxy.ContextDialer = (*Dialer)(nil)
+
+// NewDialer creates a dialer through the target peer.
+func NewDialer(client Client, target *Target) *Dialer {
+	return &Dialer{
+		Client: client,
+		Target: target,
+	}
+}
+
+// Dial connects to the address on the named network.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using the provided context.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return d.Client.Dial(ctx, d.Target, network, address)
+}
@@ -0,0 +1,290 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-zoox/gzfly/dns"
+	"github.com/go-zoox/gzfly/router"
+	"github.com/go-zoox/logger"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSTimeout is the timeout of a query to the upstream resolver.
+var DNSTimeout = 5 * time.Second
+
+// DNS is a local dns server (udp and tcp), forwarding queries to the resolver
+// on the target's network, so that private names there can be resolved locally.
+type DNS struct {
+	IP   string
+	Port int
+	// Upstream is the resolver on the target's side, format: [udp|tcp://]host[:port]
+	Upstream string
+	// Local is the resolver used for DIRECT rules, format as Upstream
+	Local string
+	// CacheSize is the max responses cached, DefaultCacheSize if zero
+	CacheSize int
+	//
+	Target *Target
+	// Router decides per domain to resolve locally, reject or use a target,
+	// the default target is used if no rule matches.
+	Router *router.Router
+	// Targets are the named targets used as rule actions
+	Targets map[string]*Target
+}
+
+type dnsUpstream struct {
+	Network string
+	Address string
+}
+
+func (u *dnsUpstream) String() string {
+	return fmt.Sprintf("%s://%s", u.Network, u.Address)
+}
+
+func parseDNSUpstream(upstream string) (*dnsUpstream, error) {
+	network := "udp"
+	address := upstream
+	if index := strings.Index(upstream, "://"); index != -1 {
+		network = upstream[:index]
+		address = upstream[index+3:]
+	}
+
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unknown network type: %s, only support tcp/udp", network)
+	}
+
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(strings.Trim(address, "[]"), "53")
+	}
+
+	if _, _, err := splitHostPort(address); err != nil {
+		return nil, err
+	}
+
+	return &dnsUpstream{
+		Network: network,
+		Address: address,
+	}, nil
+}
+
+func (c *client) DNSServe(cfg *DNS) error {
+	logger.Info(
+		"[dns] start to dns serve with target(%s): %s:%d => %s",
+		cfg.Target.GetUserClientID(),
+		cfg.IP,
+		cfg.Port,
+		cfg.Upstream,
+	)
+
+	upstream, err := parseDNSUpstream(cfg.Upstream)
+	if err != nil {
+		return fmt.Errorf("invalid dns upstream(%s): %v", cfg.Upstream, err)
+	}
+
+	var local *dnsUpstream
+	if cfg.Local != "" {
+		local, err = parseDNSUpstream(cfg.Local)
+		if err != nil {
+			return fmt.Errorf("invalid dns local(%s): %v", cfg.Local, err)
+		}
+	}
+
+	cache := dns.NewCache(cfg.CacheSize)
+
+	resolve := func(query []byte) []byte {
+		header, question, err := dns.Question(query)
+		if err != nil {
+			logger.Warnf("[dns] invalid query: %v", err)
+			return nil
+		}
+
+		domain := dns.Domain(question)
+		key := dns.Key(question)
+		if response, ok := cache.Get(key); ok {
+			logger.Debugf("[dns][cache] %s %s", domain, question.Type)
+			dns.SetID(response, header.ID)
+			return response
+		}
+
+		var dial func(ctx context.Context, network, address string) (net.Conn, error)
+		resolver := upstream
+		target := cfg.Target
+		action := router.ActionPeer
+		if cfg.Router != nil {
+			if rule := cfg.Router.Match(domain, 53); rule != nil {
+				logger.Infof("[dns][rule: %s (line %d)] %s", rule, rule.Line, domain)
+				action = rule.Action
+			}
+		}
+
+		switch action {
+		case router.ActionDirect:
+			if local == nil {
+				logger.Errorf("[dns] no local resolver for %s", domain)
+				return dnsReply(query, dnsmessage.RCodeServerFailure)
+			}
+			dial = (&net.Dialer{}).DialContext
+			resolver = local
+		case router.ActionReject:
+			return dnsReply(query, dnsmessage.RCodeRefused)
+		case router.ActionPeer:
+		default:
+			t, ok := cfg.Targets[action]
+			if !ok {
+				logger.Errorf("[dns] unknown target(%s) in rules", action)
+				return dnsReply(query, dnsmessage.RCodeServerFailure)
+			}
+			target = t
+		}
+
+		if dial == nil {
+			dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+				return c.Dial(ctx, target, network, address)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), DNSTimeout)
+		defer cancel()
+
+		response, err := dnsExchange(ctx, dial, resolver, query)
+		if err != nil {
+			logger.Errorf("[dns] failed to resolve %s %s with %s: %v", domain, question.Type, resolver, err)
+			return dnsReply(query, dnsmessage.RCodeServerFailure)
+		}
+
+		logger.Infof("[dns] resolve %s %s with %s", domain, question.Type, resolver)
+		cache.Set(key, response, dns.TTL(response))
+		return response
+	}
+
+	address := net.JoinHostPort(cfg.IP, fmt.Sprintf("%d", cfg.Port))
+	packetConn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen dns udp server: %v", err)
+	}
+	defer packetConn.Close()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen dns tcp server: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		buf := make([]byte, dns.MaxMessageSize)
+		for {
+			n, addr, err := packetConn.ReadFrom(buf)
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					logger.Errorf("[dns] failed to read udp: %v", err)
+				}
+				return
+			}
+
+			query := make([]byte, n)
+			copy(query, buf[:n])
+			go func() {
+				if response := resolve(query); response != nil {
+					if _, err := packetConn.WriteTo(response, addr); err != nil {
+						logger.Errorf("[dns] failed to write udp to %s: %v", addr, err)
+					}
+				}
+			}()
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept dns tcp: %v", err)
+		}
+
+		go func() {
+			defer conn.Close()
+			for {
+				query, err := dns.ReadTCP(conn)
+				if err != nil {
+					return
+				}
+
+				response := resolve(query)
+				if response == nil {
+					return
+				}
+
+				if err := dns.WriteTCP(conn, response); err != nil {
+					logger.Errorf("[dns] failed to write tcp to %s: %v", conn.RemoteAddr(), err)
+					return
+				}
+			}
+		}()
+	}
+}
+
+func dnsReply(query []byte, rcode dnsmessage.RCode) []byte {
+	response, err := dns.Reply(query, rcode)
+	if err != nil {
+		logger.Errorf("[dns] failed to build reply: %v", err)
+		return nil
+	}
+
+	return response
+}
+
+// dnsExchange sends the query to resolver and waits for the response,
+// each query uses its own connection, so that datagrams are never mixed.
+func dnsExchange(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), resolver *dnsUpstream, query []byte) ([]byte, error) {
+	conn, err := dial(ctx, resolver.Network, resolver.Address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	type result struct {
+		response []byte
+		err      error
+	}
+	resultCh := make(chan result, 1)
+
+	go func() {
+		var response []byte
+		var err error
+		if resolver.Network == "tcp" {
+			if err = dns.WriteTCP(conn, query); err == nil {
+				response, err = dns.ReadTCP(conn)
+			}
+		} else {
+			if _, err = conn.Write(query); err == nil {
+				buf := make([]byte, dns.MaxMessageSize)
+				var n int
+				n, err = conn.Read(buf)
+				response = buf[:n]
+			}
+		}
+
+		resultCh <- result{response, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-resultCh:
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		if len(r.response) < 2 || r.response[0] != query[0] || r.response[1] != query[1] {
+			return nil, fmt.Errorf("mismatched response id")
+		}
+
+		return r.response, nil
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/go-zoox/gzfly/network"
+	"github.com/go-zoox/gzfly/network/upstream"
+	"github.com/go-zoox/gzfly/router"
+	"github.com/go-zoox/logger"
+)
+
+// Egress decides how tcp destinations requested by peers, or routed DIRECT by our rules,
+// are dialed, directly or through upstream proxies, udp and unix are always dialed directly.
+type Egress struct {
+	// Proxy is the default upstream proxy, nil dials directly
+	Proxy *upstream.Proxy
+	// Router decides per destination to dial directly, reject or use a proxy,
+	// the default proxy is used if no rule matches.
+	Router *router.Router
+	// Proxies are the named proxies used as rule actions
+	Proxies map[string]*upstream.Proxy
+}
+
+// egressDialOptions returns the options to dial the destination of handshake with,
+// the proxy is chosen by egress rules.
+func (c *client) egressDialOptions(Network string, host string, port int) (*network.DialOptions, error) {
+	if c.egress == nil || Network != "tcp" {
+		return c.dialOptions, nil
+	}
+
+	address := formatAddress(host, port)
+	proxy := c.egress.Proxy
+	if c.egress.Router != nil {
+		if rule := c.egress.Router.Match(host, port); rule != nil {
+			logger.Infof("[egress][rule: %s (line %d)] %s", rule, rule.Line, address)
+
+			switch rule.Action {
+			case router.ActionDirect:
+				proxy = nil
+			case router.ActionReject:
+				return nil, fmt.Errorf("%s is rejected by egress rules", address)
+			case router.ActionProxy:
+			default:
+				p, ok := c.egress.Proxies[rule.Action]
+				if !ok {
+					return nil, fmt.Errorf("unknown proxy(%s) in egress rules", rule.Action)
+				}
+				proxy = p
+			}
+		}
+	}
+
+	if proxy == nil {
+		return c.dialOptions, nil
+	}
+
+	logger.Infof("[egress] connect to %s via %s", address, proxy)
+
+	options := &network.DialOptions{}
+	if c.dialOptions != nil {
+		*options = *c.dialOptions
+	}
+	options.Proxy = proxy
+	return options, nil
+}
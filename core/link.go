@@ -0,0 +1,337 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-zoox/gzfly/connection"
+	"github.com/go-zoox/gzfly/scheduler"
+	"github.com/go-zoox/gzfly/transport"
+	"github.com/go-zoox/logger"
+	"github.com/go-zoox/packet/socksz"
+	"github.com/go-zoox/packet/socksz/authenticate"
+	"github.com/go-zoox/packet/socksz/base"
+	"github.com/go-zoox/retry"
+	"github.com/gorilla/websocket"
+)
+
+// link is one authenticated link to the relay, of any transport, a client opens Links of them
+// in one session, and connections are spread over them by hash of connection id.
+type link struct {
+	sync.Mutex
+
+	Index int
+	Conn  transport.Conn
+	// IsOnline is read by writers of connections while the link reconnects
+	IsOnline atomic.Bool
+	// scheduler interleaves frames of connections sent through the link
+	scheduler *scheduler.Scheduler
+}
+
+// serve writes frames from the scheduler, until the scheduler is closed.
+func (l *link) serve() {
+	for {
+		frame, err := l.scheduler.Next()
+		if err != nil {
+			return
+		}
+
+		if err := l.Write(MessageTypeBinary, frame); err != nil {
+			logger.Errorf("[ws][link: %d] failed to write: %v", l.Index, err)
+		}
+	}
+}
+
+func (l *link) Write(messageType int, data []byte) error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.Conn == nil {
+		return fmt.Errorf("conn is not online")
+	}
+
+	return l.Conn.WriteMessage(messageType, data)
+}
+
+// isOnline returns true if any link is online.
+func (c *client) isOnline() bool {
+	for _, l := range c.links {
+		if l.IsOnline.Load() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getLink returns the link used by connection, or the first online one if id is empty,
+// frames of one connection always go through the link it is pinned to, see pinLink.
+func (c *client) getLink(id string) (*link, error) {
+	// connections on direct links never fall back to the relay, peers would not know them
+	if id != "" {
+		if p, err := c.peerConns.Get(id); err == nil {
+			if !p.IsOnline.Load() {
+				return nil, fmt.Errorf("direct link with %s is down", p.UserClientID)
+			}
+
+			return p.link, nil
+		}
+
+		if l, err := c.linkConns.Get(id); err == nil {
+			if !l.IsOnline.Load() {
+				return nil, fmt.Errorf("link %d is down", l.Index)
+			}
+
+			return l, nil
+		}
+	}
+
+	return c.hashLink(id)
+}
+
+// pinLink keeps connection on one of the online links, until it is closed or the link is down,
+// nothing orders frames of a connection across links.
+func (c *client) pinLink(id string) {
+	if l, err := c.hashLink(id); err == nil {
+		c.linkConns.Set(id, l)
+	}
+}
+
+// abortLinkConns aborts the connections on link which is down,
+// frames in flight on it are lost, the connections cannot move to other links.
+func (c *client) abortLinkConns(l *link, reason error) {
+	for _, id := range c.linkConns.Keys() {
+		if owner, err := c.linkConns.Get(id); err != nil || owner != l {
+			continue
+		}
+
+		c.linkConns.Remove(id)
+		if conn, err := c.connections.Get(id); err == nil {
+			conn.Abort(fmt.Errorf("link %d is down: %v", l.Index, reason))
+		}
+	}
+}
+
+// hashLink returns one of the online links by hash of connection id, the first one if id is empty.
+func (c *client) hashLink(id string) (*link, error) {
+	online := make([]*link, 0, len(c.links))
+	for _, l := range c.links {
+		if l.IsOnline.Load() {
+			online = append(online, l)
+		}
+	}
+
+	if len(online) == 0 {
+		return nil, fmt.Errorf("conn is not online")
+	}
+
+	if id == "" {
+		return online[0], nil
+	}
+
+	return online[connection.LinkIndex(id, len(online))], nil
+}
+
+// writeTo queues data to the scheduler of the link of connection,
+// forward frames block while the queue of connection is full, until any of cancel is closed.
+func (c *client) writeTo(id string, class scheduler.Class, data []byte, cancel ...<-chan struct{}) error {
+	l, err := c.getLink(id)
+	if err != nil {
+		return err
+	}
+
+	// data is an encoded base packet: VER|CMD|...
+	bounded := len(data) > 1 && data[1] == socksz.CommandForward
+	if err := l.scheduler.Push(id, class, data, bounded, cancel...); err != nil {
+		return err
+	}
+
+	// the close is the last frame of connection on its link
+	if id != "" && len(data) > 1 && data[1] == socksz.CommandClose {
+		c.peerConns.Remove(id)
+		c.linkConns.Remove(id)
+	}
+
+	return nil
+}
+
+// request connects the link and authenticates, link 0 fails over between relays,
+// extra links join it at the current relay.
+func (c *client) request(l *link) error {
+	if l.Index == 0 {
+		return c.requestFailover(l)
+	}
+
+	return c.requestRelay(l, c.currentRelay())
+}
+
+func (c *client) requestRelay(l *link, relay *Relay) error {
+	if l.Conn == nil {
+		u := url.URL{
+			Scheme:   relay.Protocol,
+			Host:     net.JoinHostPort(relay.Host, fmt.Sprintf("%d", relay.Port)),
+			Path:     relay.Path,
+			RawQuery: url.Values{"session": {c.Session}}.Encode(),
+		}
+		conn, err := transport.Dial(&u, &transport.DialConfig{
+			TLS:    c.relayTLS,
+			Proxy:  c.relayProxy,
+			Header: c.relayHeaders,
+			Stream: streamOf,
+		})
+		if err != nil {
+			return err
+		}
+
+		l.Lock()
+		l.Conn = conn
+		l.Unlock()
+	}
+
+	// authentication
+	if err := c.authenticate(l); err != nil {
+		return fmt.Errorf("failed to authenticate: %v", err)
+	}
+
+	// the first message is the authenticate response
+	_, message, err := l.Conn.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("failed to read authenticate response: %v", err)
+	}
+
+	packet := &base.Base{}
+	if err := packet.Decode(message); err != nil || packet.Cmd != socksz.CommandAuthenticate {
+		return fmt.Errorf("invalid authenticate response")
+	}
+
+	authenticatePacket := &authenticate.Response{}
+	if err := authenticatePacket.Decode(packet.Data); err != nil {
+		logger.Error("[authenticate] failed to decode authenticate response: %v", err)
+		os.Exit(-1)
+	}
+
+	if authenticatePacket.Status != socksz.StatusOK {
+		switch authenticatePacket.Status {
+		case STATUS_INVALID_USER_CLIENT_ID, STATUS_INVALID_SIGNATURE:
+			logger.Error("[authenticate] client id or secret not correct: %s", authenticatePacket.Message)
+			// other relays would not accept them either
+			os.Exit(-1)
+		case STATUS_TOKEN_EXPIRED:
+			logger.Error("[authenticate] token expired, a new one is required")
+			os.Exit(-1)
+		case STATUS_CRYPTO_NOT_ALLOWED:
+			logger.Error("[authenticate] %s", authenticatePacket.Message)
+			os.Exit(-1)
+		default:
+			logger.Error("[authenticate][link: %d] failed to authenticate, status: %d, message: %s", l.Index, authenticatePacket.Status, authenticatePacket.Message)
+		}
+
+		// extra links are optional, for example, the relay does not support sessions
+		if l.Index != 0 {
+			return errLinkRejected
+		}
+
+		return fmt.Errorf("rejected by relay (status: %d): %s", authenticatePacket.Status, authenticatePacket.Message)
+	}
+
+	l.IsOnline.Store(true)
+	logger.Info("[authenticate][link: %d] succeed to auth as %s", l.Index, c.User.GetClientID())
+
+	if l.Index == 0 && c.onConnect != nil {
+		go c.onConnect()
+	}
+
+	// heart beat
+	go func(conn transport.Conn) {
+		for {
+			// logger.Info("ping")
+			time.Sleep(15 * time.Second)
+
+			if l.Conn != conn {
+				return
+			}
+
+			if err := l.Write(MessageTypePing, []byte{}); err != nil {
+				return
+			}
+		}
+	}(l.Conn)
+
+	return nil
+}
+
+var errLinkRejected = fmt.Errorf("link is rejected by relay")
+
+func (c *client) connect(l *link) error {
+	if err := c.request(l); err != nil {
+		return err
+	}
+
+	for {
+		mt, message, err := l.Conn.ReadMessage()
+		if err != nil {
+			l.IsOnline.Store(false)
+			c.abortLinkConns(l, err)
+
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				l.Conn.Close()
+				return nil
+			}
+
+			logger.Errorf("[ws][link: %d] read err: %s (type: %d)", l.Index, err, mt)
+
+			return retry.Retry(func() error {
+				return c.reconnect(l)
+			}, 10, 5*time.Second)
+		}
+
+		switch mt {
+		case websocket.TextMessage:
+			if c.OnTextMessage != nil {
+				c.OnTextMessage(message)
+			}
+		case websocket.BinaryMessage:
+			if c.OnBinaryMessage != nil {
+				c.OnBinaryMessage(message)
+			}
+		case websocket.CloseMessage:
+			// @TODO
+		case websocket.PingMessage:
+			if c.OnPing != nil {
+				c.OnPing()
+			}
+		case websocket.PongMessage:
+			if c.OnPong != nil {
+				c.OnPong()
+			}
+		default:
+			fmt.Printf("unknown message type: %d\n", mt)
+		}
+
+		if c.OnMessage != nil {
+			c.OnMessage(mt, message)
+		}
+	}
+}
+
+func (c *client) reconnect(l *link) error {
+	logger.Infof("[ws][link: %d] reconnecting ...", l.Index)
+	// the relay drops remote binds of offline users
+	if !c.isOnline() {
+		c.closeRemoteBindListeners()
+	}
+
+	l.Lock()
+	if l.Conn != nil {
+		l.Conn.Close()
+		l.Conn = nil
+	}
+	l.Unlock()
+
+	return c.connect(l)
+}
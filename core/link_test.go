@@ -0,0 +1,69 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-zoox/gzfly/connection"
+)
+
+func TestLinkDownAbortsItsConnections(t *testing.T) {
+	port := startRelay(t, &ServerConfig{})
+	a := startClient(t, port, "id_peer_a", &ClientConfig{Links: 2})
+	b := startClient(t, port, "id_peer_b", &ClientConfig{Links: 2})
+	echo := startEcho(t)
+	target := testTarget("id_peer_b")
+
+	waitFor(t, "all links are up", func() bool {
+		for _, l := range a.links {
+			if !l.IsOnline.Load() {
+				return false
+			}
+		}
+		return true
+	})
+
+	// connections by link they are pinned to
+	conns := map[*link][]*connection.WSConn{}
+	for i := 0; i < 32 && len(conns) < 2; i++ {
+		conn := dialEcho(t, a, target, echo)
+		l, err := a.linkConns.Get(conn.ID)
+		if err != nil {
+			t.Fatalf("expect connection pinned to a link: %v", err)
+		}
+		conns[l] = append(conns[l], conn)
+	}
+	if len(conns) != 2 {
+		t.Fatal("expect connections on both links")
+	}
+
+	down, up := a.links[0], a.links[1]
+	down.Lock()
+	down.Conn.Close()
+	down.Unlock()
+
+	// connections on the link are aborted on both sides, they do not move to the other link
+	for _, conn := range conns[down] {
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Fatal("expect the connection aborted with its link")
+		}
+
+		id := conn.ID
+		waitFor(t, "target drops the connection", func() bool {
+			_, err := b.connections.Get(id)
+			return err != nil
+		})
+	}
+
+	// the others stay on their link
+	for _, conn := range conns[up] {
+		roundTrip(t, conn)
+		if l, err := a.linkConns.Get(conn.ID); err != nil || l != up {
+			t.Fatal("expect the connection to stay on its link")
+		}
+	}
+
+	waitFor(t, "link is up again", down.IsOnline.Load)
+	dialEcho(t, a, target, echo)
+}
@@ -0,0 +1,630 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/protocol/p2p"
+	"github.com/go-zoox/gzfly/scheduler"
+	"github.com/go-zoox/gzfly/transport"
+	"github.com/go-zoox/gzfly/user"
+	"github.com/go-zoox/logger"
+	"github.com/go-zoox/packet/socksz"
+	"github.com/go-zoox/packet/socksz/base"
+	"github.com/go-zoox/packet/socksz/handshake"
+	"github.com/go-zoox/zoox/components/application/websocket"
+)
+
+// PeerTimeout is the max time to set up a direct link, connections go through the relay meanwhile.
+const PeerTimeout = 10 * time.Second
+
+// PeerRetryInterval is how long connections keep going through the relay after a direct link failed.
+const PeerRetryInterval = time.Minute
+
+// P2P enables direct links with peers, both peers must enable it.
+// Candidate addresses are exchanged through the relay once we connect to a peer,
+// connections opened after the link is up skip the relay, and the relay is used
+// whenever the link cannot be set up.
+type P2P struct {
+	// Listen is the udp address of direct links, default :0 (any port)
+	Listen string
+}
+
+// peer is the direct link with another client, it carries frames of connections
+// opened after it is up, which are encrypted by the link instead of CRYPTO.
+type peer struct {
+	*link
+	UserClientID string
+	// expiry closes the link once the token session of either side ends
+	expiry atomic.Pointer[time.Timer]
+	//
+	closeOnce sync.Once
+}
+
+// serve writes frames from the scheduler, until the link is closed.
+func (p *peer) serve() {
+	for {
+		frame, err := p.scheduler.Next()
+		if err != nil {
+			return
+		}
+
+		if err := p.Write(MessageTypeBinary, frame); err != nil {
+			logger.Errorf("[p2p][peer: %s] failed to write: %v", p.UserClientID, err)
+		}
+	}
+}
+
+// peerOffer is the offer of direct link, ours waiting for the answer,
+// or the one of peer waiting for its dial.
+type peerOffer struct {
+	ID           string
+	UserClientID string
+	// ExpiresAt is when the session of peer ends, see p2p.Offer
+	ExpiresAt int64
+	//
+	AnswerCh chan *p2p.Answer
+}
+
+// peerEndpoint returns the udp endpoint of direct links, it is listened on first use.
+func (c *client) peerEndpoint() (*transport.Endpoint, error) {
+	c.peerMu.Lock()
+	defer c.peerMu.Unlock()
+
+	if c.endpoint != nil {
+		return c.endpoint, nil
+	}
+
+	address := c.p2p.Listen
+	if address == "" {
+		address = ":0"
+	}
+
+	endpoint, err := transport.ListenEndpoint(address, streamOf)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("[p2p] listen direct links at udp://%s", endpoint.Addr())
+	c.endpoint = endpoint
+	go c.acceptPeers(endpoint)
+
+	return endpoint, nil
+}
+
+// directPeer returns the direct link with target, if there is none, it starts to set up
+// one in background for later connections, at most once per PeerRetryInterval.
+func (c *client) directPeer(target *Target) *peer {
+	if c.p2p == nil {
+		return nil
+	}
+
+	if p, err := c.peers.Get(target.UserClientID); err == nil {
+		return p
+	}
+
+	c.peerMu.Lock()
+	if last, ok := c.peerAttempts[target.UserClientID]; ok && time.Since(last) < PeerRetryInterval {
+		c.peerMu.Unlock()
+		return nil
+	}
+	c.peerAttempts[target.UserClientID] = time.Now()
+	c.peerMu.Unlock()
+
+	go func() {
+		if err := c.offerPeer(target); err != nil {
+			logger.Warnf("[p2p][peer: %s] failed to set up direct link, use the relay: %v", target.UserClientID, err)
+		}
+	}()
+
+	return nil
+}
+
+// offerPeer sends the offer of direct link to target through the relay,
+// then dials the candidates of its answer.
+func (c *client) offerPeer(target *Target) error {
+	endpoint, err := c.peerEndpoint()
+	if err != nil {
+		return err
+	}
+
+	offer := &peerOffer{
+		ID:           socksz.GenerateID(),
+		UserClientID: target.UserClientID,
+		AnswerCh:     make(chan *p2p.Answer, 1),
+	}
+	c.peerOffers.Set(offer.ID, offer)
+	defer c.peerOffers.Remove(offer.ID)
+
+	dataPacket := &p2p.Offer{
+		Secret: target.UserPairKey,
+		//
+		PeerID:             offer.ID,
+		SourceUserClientID: c.User.GetClientID(),
+		TargetUserClientID: target.UserClientID,
+		Fingerprint:        endpoint.Fingerprint,
+		Candidates:         endpoint.Candidates(),
+	}
+	data, err := dataPacket.Encode()
+	if err != nil {
+		return fmt.Errorf("failed to encode peer offer: %v", err)
+	}
+
+	logger.Infof("[p2p][peer: %s] offer direct link (candidates: %s)", target.UserClientID, strings.Join(dataPacket.Candidates, ","))
+	if err := c.writePacket(protocol.CommandPeerOffer, data); err != nil {
+		return fmt.Errorf("failed to write peer offer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), PeerTimeout)
+	defer cancel()
+
+	var answer *p2p.Answer
+	select {
+	case answer = <-offer.AnswerCh:
+	case <-ctx.Done():
+		return fmt.Errorf("no answer from peer: %v", ctx.Err())
+	}
+
+	if answer.Status != STATUS_OK {
+		return fmt.Errorf("rejected (status: %d): %s", answer.Status, answer.Message)
+	}
+
+	conn, err := c.dialPeer(ctx, endpoint, answer)
+	if err != nil {
+		return err
+	}
+
+	// the peer accepts the link by the id of offer
+	request := &url.URL{Path: "/", RawQuery: url.Values{"peer": {offer.ID}}.Encode()}
+	if err := transport.WriteRequest(conn, request); err != nil {
+		return err
+	}
+
+	c.addPeer(target.UserClientID, conn, answer.ExpiresAt)
+	return nil
+}
+
+// dialPeer dials all candidates of answer at the same time, the first link up wins.
+func (c *client) dialPeer(ctx context.Context, endpoint *transport.Endpoint, answer *p2p.Answer) (transport.Conn, error) {
+	if len(answer.Candidates) == 0 {
+		return nil, fmt.Errorf("no candidate from peer")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn transport.Conn
+		err  error
+	}
+	results := make(chan result, len(answer.Candidates))
+	for _, candidate := range answer.Candidates {
+		go func(candidate string) {
+			conn, err := endpoint.Dial(ctx, candidate, answer.Fingerprint)
+			if err != nil {
+				err = fmt.Errorf("%s: %v", candidate, err)
+			}
+			results <- result{conn, err}
+		}(candidate)
+	}
+
+	var conn transport.Conn
+	errs := []string{}
+	for range answer.Candidates {
+		r := <-results
+		if r.err != nil {
+			errs = append(errs, r.err.Error())
+			continue
+		}
+
+		if conn != nil {
+			r.conn.Close()
+			continue
+		}
+
+		conn = r.conn
+		cancel()
+	}
+
+	if conn == nil {
+		return nil, fmt.Errorf("failed to reach peer (%s)", strings.Join(errs, "; "))
+	}
+
+	return conn, nil
+}
+
+// acceptPeers accepts direct links dialed for the offers we answered.
+func (c *client) acceptPeers(endpoint *transport.Endpoint) {
+	for {
+		conn, err := endpoint.Accept()
+		if err != nil {
+			logger.Errorf("[p2p] failed to accept direct link: %v", err)
+			return
+		}
+
+		go func() {
+			request, err := transport.ReadRequest(conn)
+			if err != nil {
+				// the dialer keeps only one of links to our candidates
+				logger.Debugf("[p2p] failed to read request of %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+
+			id := request.Query().Get("peer")
+			offer, err := c.peerAnswers.Get(id)
+			if err != nil {
+				logger.Warnf("[p2p] reject direct link from %s: unknown offer(%s)", conn.RemoteAddr(), id)
+				conn.Close()
+				return
+			}
+			c.peerAnswers.Remove(id)
+
+			c.addPeer(offer.UserClientID, conn, offer.ExpiresAt)
+		}()
+	}
+}
+
+// addPeer uses conn as the direct link with user, instead of the former one if any,
+// until expiresAt (unix seconds) if not 0.
+func (c *client) addPeer(userClientID string, conn transport.Conn, expiresAt int64) {
+	p := &peer{
+		link: &link{
+			Conn:      conn,
+			scheduler: scheduler.New(c.queueSize),
+		},
+		UserClientID: userClientID,
+	}
+	p.IsOnline.Store(true)
+
+	if former, err := c.peers.Get(userClientID); err == nil {
+		c.removePeer(former, fmt.Errorf("replaced by %s", conn.RemoteAddr()))
+	}
+	c.peers.Set(userClientID, p)
+
+	// the relay ends the session then, the direct link must not outlive it
+	if expiresAt != 0 {
+		p.expiry.Store(time.AfterFunc(time.Until(time.Unix(expiresAt, 0)), func() {
+			c.removePeer(p, fmt.Errorf("session expired at %s", time.Unix(expiresAt, 0).Format(time.RFC3339)))
+		}))
+	}
+
+	logger.Infof("[p2p][peer: %s] direct link is up (remote: %s)", userClientID, conn.RemoteAddr())
+	go p.serve()
+	go c.readPeer(p)
+}
+
+// removePeer closes the direct link, connections on it are aborted,
+// since frames in flight cannot move to the relay.
+func (c *client) removePeer(p *peer, reason error) {
+	p.closeOnce.Do(func() {
+		if current, err := c.peers.Get(p.UserClientID); err == nil && current == p {
+			c.peers.Remove(p.UserClientID)
+		}
+
+		p.IsOnline.Store(false)
+		if expiry := p.expiry.Load(); expiry != nil {
+			expiry.Stop()
+		}
+		p.scheduler.Close()
+		p.Conn.Close()
+
+		for _, id := range c.peerConns.Keys() {
+			if owner, err := c.peerConns.Get(id); err != nil || owner != p {
+				continue
+			}
+
+			c.peerConns.Remove(id)
+			c.linkConns.Remove(id)
+			if conn, err := c.connections.Get(id); err == nil {
+				conn.Abort(fmt.Errorf("direct link with %s is down: %v", p.UserClientID, reason))
+			}
+		}
+
+		logger.Warnf("[p2p][peer: %s] direct link is down: %v", p.UserClientID, reason)
+	})
+}
+
+// readPeer handles frames of the direct link as the ones from the relay,
+// peer may only send frames of connections on the link, or handshakes of new ones.
+func (c *client) readPeer(p *peer) {
+	for {
+		mt, message, err := p.Conn.ReadMessage()
+		if err != nil {
+			c.removePeer(p, err)
+			return
+		}
+
+		if mt != MessageTypeBinary {
+			continue
+		}
+
+		id, _ := streamOf(message)
+		if id == "" {
+			logger.Warnf("[p2p][peer: %s] ignore frame without connection", p.UserClientID)
+			continue
+		}
+
+		if message[1] == socksz.CommandHandshakeRequest {
+			c.peerConns.Set(id, p)
+		} else if owner, err := c.peerConns.Get(id); err != nil || owner != p {
+			logger.Debugf("[p2p][peer: %s][connection: %s] ignore frame of connection not on the link", p.UserClientID, id)
+			continue
+		}
+
+		c.OnBinaryMessage(message)
+
+		if message[1] == socksz.CommandClose {
+			c.peerConns.Remove(id)
+		}
+	}
+}
+
+// cryptoOf returns the CRYPTO of frames of connection, frames on direct links are plain,
+// they are never decrypted and encrypted again by the relay.
+func (c *client) cryptoOf(id string) uint8 {
+	if _, err := c.peerConns.Get(id); err == nil {
+		return 0
+	}
+
+	return c.Crypto
+}
+
+// answerPeerHandshake writes the handshake response of connection requested on a direct link,
+// which the relay writes for connections through it.
+func (c *client) answerPeerHandshake(id string, status uint8, err error) {
+	p, errx := c.peerConns.Get(id)
+	if errx != nil {
+		return
+	}
+
+	dataPacket := &handshake.Response{
+		ConnectionID: id,
+		Status:       status,
+	}
+	if err != nil {
+		dataPacket.Message = err.Error()
+	}
+
+	data, errx := dataPacket.Encode()
+	if errx != nil {
+		logger.Errorf("[p2p][peer: %s][connection: %s] failed to encode handshake response: %v", p.UserClientID, id, errx)
+		return
+	}
+
+	if errx := c.writePacketTo(id, socksz.CommandHandshakeResponse, data); errx != nil {
+		logger.Errorf("[p2p][peer: %s][connection: %s] failed to write handshake response: %v", p.UserClientID, id, errx)
+	}
+
+	// the source gives up the connection on failure, no close is expected
+	if status != STATUS_OK {
+		c.peerConns.Remove(id)
+	}
+}
+
+// handlePeerOffer answers the offer of direct link from peer, then waits for its dial.
+func (c *client) handlePeerOffer(offer *p2p.Offer) {
+	answer := &p2p.Answer{
+		PeerID: offer.PeerID,
+		Status: STATUS_OK,
+	}
+
+	offer.Secret = c.User.PairKey
+	if err := offer.Verify(); err != nil {
+		answer.Status = STATUS_INVALID_SIGNATURE
+		answer.Message = err.Error()
+	} else if c.p2p == nil {
+		answer.Status = STATUS_P2P_DISABLED
+		answer.Message = "p2p is disabled"
+	} else if endpoint, err := c.peerEndpoint(); err != nil {
+		answer.Status = STATUS_FAILED_TO_LISTEN
+		answer.Message = err.Error()
+	} else {
+		answer.Fingerprint = endpoint.Fingerprint
+		answer.Candidates = endpoint.Candidates()
+
+		c.peerAnswers.Set(offer.PeerID, &peerOffer{
+			ID:           offer.PeerID,
+			UserClientID: offer.SourceUserClientID,
+			ExpiresAt:    offer.ExpiresAt,
+		})
+		time.AfterFunc(PeerTimeout, func() {
+			c.peerAnswers.Remove(offer.PeerID)
+		})
+
+		// open our NAT for dials of peer
+		for _, candidate := range offer.Candidates {
+			if err := endpoint.Punch(candidate); err != nil {
+				logger.Debugf("[p2p][peer: %s] failed to punch %s: %v", offer.SourceUserClientID, candidate, err)
+			}
+		}
+	}
+
+	if answer.Status != STATUS_OK {
+		logger.Warnf("[p2p][peer: %s] reject direct link: %s", offer.SourceUserClientID, answer.Message)
+	} else {
+		logger.Infof("[p2p][peer: %s] answer direct link (candidates: %s)", offer.SourceUserClientID, strings.Join(answer.Candidates, ","))
+	}
+
+	data, err := answer.Encode()
+	if err != nil {
+		logger.Errorf("[p2p][peer: %s] failed to encode peer answer: %v", offer.SourceUserClientID, err)
+		return
+	}
+
+	if err := c.writePacket(protocol.CommandPeerAnswer, data); err != nil {
+		logger.Errorf("[p2p][peer: %s] failed to write peer answer: %v", offer.SourceUserClientID, err)
+	}
+}
+
+// handlePeerAnswer hands over the answer to the offer waiting for it.
+func (c *client) handlePeerAnswer(answer *p2p.Answer) {
+	offer, err := c.peerOffers.Get(answer.PeerID)
+	if err != nil {
+		logger.Debugf("[p2p] ignore answer of unknown offer(%s)", answer.PeerID)
+		return
+	}
+
+	select {
+	case offer.AnswerCh <- answer:
+	default:
+	}
+}
+
+// handlePeerOffer verifies the offer of direct link and forwards it to the target,
+// with the address the source is seen at by the relay.
+func (s *server) handlePeerOffer(currentUser *user.User, claims *TokenClaims, client *websocket.Client, packet *base.Base) {
+	offer := &p2p.Offer{}
+	if err := offer.Decode(packet.Data); err != nil {
+		logger.Error("[user: %s][p2p] failed to decode peer offer packet: %v", currentUser.GetClientID(), err)
+		return
+	}
+
+	writeAnswer := func(status uint8, err error) {
+		logger.Error("[user: %s][p2p][peer: %s] failed to offer direct link(status: %d): %v", currentUser.GetClientID(), offer.PeerID, status, err)
+
+		dataPacket := &p2p.Answer{
+			PeerID: offer.PeerID,
+			Status: status,
+		}
+		if err != nil {
+			dataPacket.Message = err.Error()
+		}
+
+		data, err := dataPacket.Encode()
+		if err != nil {
+			return
+		}
+
+		npacket := &base.Base{
+			Ver:    socksz.VER,
+			Cmd:    protocol.CommandPeerAnswer,
+			Data:   data,
+			Crypto: packet.Crypto,
+		}
+		if bytes, err := npacket.Encode(); err == nil {
+			client.WriteBinary(bytes)
+		}
+	}
+
+	if offer.SourceUserClientID != currentUser.GetClientID() {
+		writeAnswer(STATUS_INVALID_USER_CLIENT_ID, fmt.Errorf("source user(%s) mismatch", offer.SourceUserClientID))
+		return
+	}
+
+	if !claims.Allows(offer.TargetUserClientID) {
+		writeAnswer(STATUS_TARGET_NOT_ALLOWED, fmt.Errorf("target %s is not allowed by token", offer.TargetUserClientID))
+		return
+	}
+
+	targetUser, err := s.Users.Get(offer.TargetUserClientID)
+	if err != nil {
+		writeAnswer(STATUS_INVALID_USER_CLIENT_ID, err)
+		return
+	}
+
+	offer.Secret = targetUser.PairKey
+	if err := offer.Verify(); err != nil {
+		writeAnswer(STATUS_FAILED_TO_PAIR, err)
+		return
+	}
+
+	if !targetUser.IsOnline() {
+		writeAnswer(STATUS_USER_NOT_ONLINE, nil)
+		return
+	}
+
+	offer.Candidates = observedCandidates(offer.Candidates, client.RemoteAddr())
+	// the target closes the direct link once the session of source ends
+	offer.ExpiresAt = claims.Expiry()
+	data, err := offer.Encode()
+	if err != nil {
+		writeAnswer(STATUS_FAILED_TO_HANDSHAKE, err)
+		return
+	}
+	packet.Data = data
+
+	// the answer is routed back by the id of offer
+	s.PeerOffers.Set(offer.PeerID, &user.Pair{
+		Source: currentUser,
+		Target: targetUser,
+	})
+	time.AfterFunc(PeerTimeout, func() {
+		s.PeerOffers.Remove(offer.PeerID)
+	})
+
+	logger.Infof("[user: %s][p2p][peer: %s] offer direct link to %s", currentUser.GetClientID(), offer.PeerID, targetUser.GetClientID())
+	if err := targetUser.WritePacket(packet); err != nil {
+		s.PeerOffers.Remove(offer.PeerID)
+		writeAnswer(STATUS_FAILED_TO_HANDSHAKE, err)
+	}
+}
+
+// handlePeerAnswer routes the answer back to the source of offer.
+func (s *server) handlePeerAnswer(currentUser *user.User, claims *TokenClaims, client *websocket.Client, packet *base.Base) {
+	answer := &p2p.Answer{}
+	if err := answer.Decode(packet.Data); err != nil {
+		logger.Error("[user: %s][p2p] failed to decode peer answer packet: %v", currentUser.GetClientID(), err)
+		return
+	}
+
+	pair, err := s.PeerOffers.Get(answer.PeerID)
+	if err != nil || pair.Target != currentUser {
+		logger.Error("[user: %s][p2p][peer: %s] failed to get peer offer", currentUser.GetClientID(), answer.PeerID)
+		return
+	}
+	s.PeerOffers.Remove(answer.PeerID)
+
+	if answer.Status == STATUS_OK {
+		answer.Candidates = observedCandidates(answer.Candidates, client.RemoteAddr())
+	}
+	// the source closes the direct link once the session of target ends
+	answer.ExpiresAt = claims.Expiry()
+	data, err := answer.Encode()
+	if err != nil {
+		logger.Error("[user: %s][p2p][peer: %s] failed to encode peer answer: %v", currentUser.GetClientID(), answer.PeerID, err)
+		return
+	}
+	packet.Data = data
+
+	if err := pair.Source.WritePacket(packet); err != nil {
+		logger.Error("[user: %s][p2p][peer: %s] failed to write answer to %s: %v", currentUser.GetClientID(), answer.PeerID, pair.Source.GetClientID(), err)
+	}
+}
+
+// observedCandidates adds the address of client seen by the relay, with ports of candidates,
+// which reaches clients behind NAT keeping the port of udp.
+func observedCandidates(candidates []string, observed net.Addr) []string {
+	host, _, err := net.SplitHostPort(observed.String())
+	if err != nil {
+		return candidates
+	}
+
+	exists := map[string]bool{}
+	for _, candidate := range candidates {
+		exists[candidate] = true
+	}
+
+	result := candidates
+	for _, candidate := range candidates {
+		_, port, err := net.SplitHostPort(candidate)
+		if err != nil {
+			continue
+		}
+
+		address := net.JoinHostPort(host, port)
+		if !exists[address] && len(result) < p2p.MaxCandidates {
+			exists[address] = true
+			result = append(result, address)
+		}
+	}
+
+	return result
+}
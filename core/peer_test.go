@@ -0,0 +1,359 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/gzfly/connection"
+	"github.com/go-zoox/gzfly/user"
+	"github.com/gorilla/websocket"
+)
+
+// testUsers are the users known to relays of tests, by client id.
+var testUsers = map[string]user.UserClient{
+	"id_peer_a": {ClientID: "id_peer_a", ClientSecret: "secret_a", PairKey: "pair_a"},
+	"id_peer_b": {ClientID: "id_peer_b", ClientSecret: "secret_b", PairKey: "pair_b"},
+}
+
+// startRelay runs a relay of testUsers on a free port of loopback, returns the port.
+func startRelay(t *testing.T, cfg *ServerConfig) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cfg.Port = int64(port)
+	cfg.Path = "/ws"
+	for _, u := range testUsers {
+		cfg.Users = append(cfg.Users, u)
+	}
+
+	// the relay has no shutdown, it stops with the test binary
+	go NewServer(cfg).Run()
+
+	waitFor(t, "relay is up", func() bool {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	})
+
+	return port
+}
+
+// startClient connects the client of user to the relay at port, until the test ends,
+// the user is of testUsers unless in cfg.
+func startClient(t *testing.T, port int, id string, cfg *ClientConfig) *client {
+	u := testUsers[id]
+	cfg.Protocol = "ws"
+	cfg.Host = "127.0.0.1"
+	cfg.Port = port
+	cfg.Path = "/ws"
+	if cfg.User == nil {
+		cfg.User = user.New(u.ClientID, u.ClientSecret, u.PairKey)
+	}
+
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go c.Listen()
+
+	cl := c.(*client)
+	waitFor(t, id+" is online", cl.isOnline)
+	t.Cleanup(func() {
+		for _, l := range cl.links {
+			l.Lock()
+			if l.Conn != nil {
+				l.Conn.Close()
+			}
+			l.Unlock()
+		}
+
+		cl.peerMu.Lock()
+		if cl.endpoint != nil {
+			cl.endpoint.Close()
+		}
+		cl.peerMu.Unlock()
+	})
+
+	return cl
+}
+
+func testTarget(id string) *Target {
+	return &Target{UserClientID: id, UserPairKey: testUsers[id].PairKey}
+}
+
+// startEcho serves an echo on loopback, returns its address.
+func startEcho(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// dialEcho dials the echo through target and checks a round trip.
+func dialEcho(t *testing.T, c *client, target *Target, echo string) *connection.WSConn {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := c.Dial(ctx, target, "tcp", echo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	roundTrip(t, conn)
+	return conn.(*connection.WSConn)
+}
+
+func roundTrip(t *testing.T, conn net.Conn) {
+	t.Helper()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatalf("expect hello, but got %q", buf)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for: %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// onPeer returns the direct link carrying connection id, nil if on the relay.
+func onPeer(c *client, id string) *peer {
+	p, err := c.peerConns.Get(id)
+	if err != nil {
+		return nil
+	}
+
+	return p
+}
+
+func TestPeerDirectLink(t *testing.T) {
+	port := startRelay(t, &ServerConfig{})
+	a := startClient(t, port, "id_peer_a", &ClientConfig{Crypto: "aes-256-gcm", P2P: &P2P{Listen: "127.0.0.1:0"}})
+	b := startClient(t, port, "id_peer_b", &ClientConfig{Crypto: "aes-256-gcm", P2P: &P2P{Listen: "127.0.0.1:0"}})
+	echo := startEcho(t)
+	target := testTarget("id_peer_b")
+
+	// the first connection goes through the relay while the direct link is set up
+	relayed := dialEcho(t, a, target, echo)
+	if onPeer(a, relayed.ID) != nil {
+		t.Fatal("expect the first connection on the relay")
+	}
+
+	waitFor(t, "direct link is up", func() bool {
+		_, errA := a.peers.Get("id_peer_b")
+		_, errB := b.peers.Get("id_peer_a")
+		return errA == nil && errB == nil
+	})
+
+	direct := dialEcho(t, a, target, echo)
+	p := onPeer(a, direct.ID)
+	if p == nil || p.UserClientID != "id_peer_b" {
+		t.Fatal("expect the connection on the direct link")
+	}
+	if l, err := a.getLink(direct.ID); err != nil || l != p.link {
+		t.Fatalf("expect frames of the connection routed to the direct link, got %v", err)
+	}
+	if onPeer(b, direct.ID) == nil {
+		t.Fatal("expect the target to know the connection on the direct link")
+	}
+
+	// connections on the relay stay there
+	roundTrip(t, relayed)
+	if onPeer(a, relayed.ID) != nil || onPeer(b, relayed.ID) != nil {
+		t.Fatal("expect the relayed connection to stay on the relay")
+	}
+
+	// closed connections leave the link on both sides
+	direct.Close()
+	waitFor(t, "connection leaves the direct link", func() bool {
+		return onPeer(a, direct.ID) == nil && onPeer(b, direct.ID) == nil
+	})
+}
+
+func TestPeerLinkDown(t *testing.T) {
+	port := startRelay(t, &ServerConfig{})
+	a := startClient(t, port, "id_peer_a", &ClientConfig{P2P: &P2P{Listen: "127.0.0.1:0"}})
+	b := startClient(t, port, "id_peer_b", &ClientConfig{P2P: &P2P{Listen: "127.0.0.1:0"}})
+	echo := startEcho(t)
+	target := testTarget("id_peer_b")
+
+	dialEcho(t, a, target, echo)
+	waitFor(t, "direct link is up", func() bool {
+		_, err := a.peers.Get("id_peer_b")
+		return err == nil
+	})
+
+	direct := dialEcho(t, a, target, echo)
+	p := onPeer(a, direct.ID)
+	if p == nil {
+		t.Fatal("expect the connection on the direct link")
+	}
+
+	a.removePeer(p, errors.New("test"))
+
+	// connections on the link are aborted, they cannot move to the relay
+	direct.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := direct.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expect the connection aborted with the direct link")
+	}
+	if onPeer(a, direct.ID) != nil {
+		t.Fatal("expect the connection removed from the direct link")
+	}
+	if _, err := a.getLink(direct.ID); err != nil {
+		t.Fatalf("expect connections of the link to fall back to the relay, got %v", err)
+	}
+
+	waitFor(t, "peer sees the link down", func() bool {
+		_, err := b.peers.Get("id_peer_a")
+		return err != nil
+	})
+
+	// new connections use the relay until the next attempt
+	relayed := dialEcho(t, a, target, echo)
+	if onPeer(a, relayed.ID) != nil || onPeer(b, relayed.ID) != nil {
+		t.Fatal("expect the connection on the relay")
+	}
+}
+
+func TestPeerRelayFallback(t *testing.T) {
+	port := startRelay(t, &ServerConfig{})
+	a := startClient(t, port, "id_peer_a", &ClientConfig{Crypto: "aes-256-gcm", P2P: &P2P{Listen: "127.0.0.1:0"}})
+	// the target does not enable direct links
+	b := startClient(t, port, "id_peer_b", &ClientConfig{Crypto: "aes-256-gcm"})
+	echo := startEcho(t)
+	target := testTarget("id_peer_b")
+
+	dialEcho(t, a, target, echo)
+
+	// the offer is rejected, connections keep using the relay
+	waitFor(t, "offer is sent", func() bool {
+		a.peerMu.Lock()
+		defer a.peerMu.Unlock()
+		return a.endpoint != nil
+	})
+	time.Sleep(100 * time.Millisecond)
+	waitFor(t, "offer is answered", func() bool {
+		return len(a.peerOffers.Keys()) == 0
+	})
+
+	for i := 0; i < 3; i++ {
+		conn := dialEcho(t, a, target, echo)
+		if onPeer(a, conn.ID) != nil || onPeer(b, conn.ID) != nil {
+			t.Fatal("expect the connection on the relay")
+		}
+	}
+
+	if _, err := a.peers.Get("id_peer_b"); err == nil {
+		t.Fatal("expect no direct link")
+	}
+}
+
+func TestPeerSessionExpiry(t *testing.T) {
+	// either side may be the one of token
+	for _, tokenUser := range []string{"id_peer_a", "id_peer_b"} {
+		t.Run(tokenUser, func(t *testing.T) {
+			port := startRelay(t, &ServerConfig{Token: ServerToken{Secret: "token_secret"}})
+
+			token, err := IssueToken("token_secret", &TokenClaims{UserClientID: tokenUser, ExpiresAt: time.Now().Add(3 * time.Second)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg := func(id string) *ClientConfig {
+				cfg := &ClientConfig{P2P: &P2P{Listen: "127.0.0.1:0"}}
+				if id == tokenUser {
+					cfg.Token = token
+				}
+				return cfg
+			}
+
+			a := startClient(t, port, "id_peer_a", cfg("id_peer_a"))
+			b := startClient(t, port, "id_peer_b", cfg("id_peer_b"))
+			echo := startEcho(t)
+			target := testTarget("id_peer_b")
+
+			dialEcho(t, a, target, echo)
+			waitFor(t, "direct link is up", func() bool {
+				_, errA := a.peers.Get("id_peer_b")
+				_, errB := b.peers.Get("id_peer_a")
+				return errA == nil && errB == nil
+			})
+			direct := dialEcho(t, a, target, echo)
+			if onPeer(a, direct.ID) == nil {
+				t.Fatal("expect the connection on the direct link")
+			}
+
+			// the token client leaves the relay, so the link can only be closed by expiry
+			other, otherPeer, leaving := b, "id_peer_a", a
+			if tokenUser == "id_peer_b" {
+				other, otherPeer, leaving = a, "id_peer_b", b
+			}
+			for _, l := range leaving.links {
+				l.Lock()
+				l.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				l.Unlock()
+			}
+			waitFor(t, "token client leaves the relay", func() bool {
+				return !leaving.isOnline()
+			})
+			if _, err := other.peers.Get(otherPeer); err != nil {
+				t.Fatal("expect the direct link to stay without the relay")
+			}
+
+			waitFor(t, "direct link is closed once the token session expires", func() bool {
+				_, err := other.peers.Get(otherPeer)
+				return err != nil
+			})
+			if onPeer(a, direct.ID) != nil {
+				t.Fatal("expect the connection removed with the direct link")
+			}
+		})
+	}
+}
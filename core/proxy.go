@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// RelayProxyDirect connects to the relay directly, ignoring proxies of the environment.
+const RelayProxyDirect = "direct"
+
+// relayProxy returns the proxy func of the dialer to the relay (websocket and tls), the explicit
+// proxy wins, otherwise HTTPS_PROXY or HTTP_PROXY, then ALL_PROXY of the environment
+// is used, except hosts in NO_PROXY.
+func relayProxy(proxy string) (func(*http.Request) (*url.URL, error), error) {
+	switch proxy {
+	case RelayProxyDirect:
+		return nil, nil
+	case "":
+		cfg := httpproxy.FromEnvironment()
+		if all := getenv("ALL_PROXY", "all_proxy"); all != "" {
+			if cfg.HTTPSProxy == "" {
+				cfg.HTTPSProxy = all
+			}
+			if cfg.HTTPProxy == "" {
+				cfg.HTTPProxy = all
+			}
+		}
+
+		proxyFunc := cfg.ProxyFunc()
+		return func(r *http.Request) (*url.URL, error) {
+			return proxyFunc(r.URL)
+		}, nil
+	}
+
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid relay proxy(%s): %v", proxy, err)
+	}
+
+	switch u.Scheme {
+	case "http", "socks5":
+	case "socks5h":
+		// hostnames are always resolved by socks5 proxies
+		u.Scheme = "socks5"
+	default:
+		return nil, fmt.Errorf("invalid relay proxy(%s): unknown scheme %s, only support http/socks5", proxy, u.Scheme)
+	}
+
+	return http.ProxyURL(u), nil
+}
+
+// getenv returns the first non-empty environment variable of names.
+func getenv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
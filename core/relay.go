@@ -0,0 +1,166 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/go-zoox/gzfly/transport"
+	"github.com/go-zoox/logger"
+)
+
+// RelayRecheckInterval is how often the client tries to return to a preferred relay after failover.
+const RelayRecheckInterval = 5 * time.Minute
+
+// Relay is one relay the client may connect to.
+// Relays do not share clients, so peers must be connected to the same relay to reach each other.
+type Relay struct {
+	// Protocol is the transport to the relay: ws, wss, tls, h2 or quic
+	Protocol string
+	Host     string
+	Port     int
+	Path     string
+	// Priority orders relays, the lower is preferred, relays of the same priority keep their order
+	Priority int
+}
+
+// String returns the url of the relay, used in logs.
+func (r *Relay) String() string {
+	u := url.URL{
+		Scheme: r.Protocol,
+		Host:   net.JoinHostPort(r.Host, fmt.Sprintf("%d", r.Port)),
+		Path:   r.Path,
+	}
+
+	return u.String()
+}
+
+// sortRelays returns relays from the preferred one.
+func sortRelays(relays []*Relay) []*Relay {
+	sorted := append([]*Relay{}, relays...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	return sorted
+}
+
+// Relay returns the url of the relay the client is using.
+func (c *client) Relay() string {
+	return c.currentRelay().String()
+}
+
+func (c *client) currentRelay() *Relay {
+	c.relayMu.Lock()
+	defer c.relayMu.Unlock()
+
+	return c.relays[c.relay]
+}
+
+// useRelay moves the session to the relay at index, links still at other relays are
+// closed, then they reconnect to it.
+func (c *client) useRelay(index int, except *link) {
+	c.relayMu.Lock()
+	if c.relay == index {
+		c.relayMu.Unlock()
+		return
+	}
+	from := c.relays[c.relay]
+	c.relay = index
+	c.relayMu.Unlock()
+
+	logger.Infof("[relay] switch from %s to %s (priority: %d)", from, c.relays[index], c.relays[index].Priority)
+
+	for _, l := range c.links {
+		if l == except {
+			continue
+		}
+
+		l.Lock()
+		if l.Conn != nil {
+			l.Conn.Close()
+		}
+		l.Unlock()
+	}
+}
+
+// requestFailover connects link 0 to the current relay, or the next ones in turn
+// if it is unreachable or rejects the link.
+func (c *client) requestFailover(l *link) error {
+	c.relayMu.Lock()
+	current := c.relay
+	c.relayMu.Unlock()
+
+	var err error
+	for i := 0; i < len(c.relays); i++ {
+		index := (current + i) % len(c.relays)
+		relay := c.relays[index]
+
+		if err = c.requestRelay(l, relay); err == nil {
+			c.useRelay(index, l)
+			logger.Infof("[relay] connected to %s (priority: %d)", relay, relay.Priority)
+			return nil
+		}
+
+		l.Lock()
+		if l.Conn != nil {
+			l.Conn.Close()
+			l.Conn = nil
+		}
+		l.Unlock()
+
+		if len(c.relays) > 1 {
+			logger.Warnf("[relay] %s is not available, try the next one: %v", relay, err)
+		}
+	}
+
+	return err
+}
+
+// recheckRelays returns to the most preferred relay reachable, every RelayRecheckInterval.
+func (c *client) recheckRelays() {
+	for {
+		time.Sleep(RelayRecheckInterval)
+
+		c.relayMu.Lock()
+		current := c.relay
+		c.relayMu.Unlock()
+
+		for index := 0; index < current; index++ {
+			relay := c.relays[index]
+			if relay.Priority == c.relays[current].Priority {
+				break
+			}
+
+			if err := c.probeRelay(relay); err != nil {
+				logger.Debugf("[relay] preferred %s is still not available: %v", relay, err)
+				continue
+			}
+
+			logger.Infof("[relay] preferred %s is available again, return to it", relay)
+			c.useRelay(index, nil)
+			break
+		}
+	}
+}
+
+// probeRelay checks whether the relay is reachable, without authentication.
+func (c *client) probeRelay(relay *Relay) error {
+	u := url.URL{
+		Scheme: relay.Protocol,
+		Host:   net.JoinHostPort(relay.Host, fmt.Sprintf("%d", relay.Port)),
+		Path:   relay.Path,
+	}
+	conn, err := transport.Dial(&u, &transport.DialConfig{
+		TLS:    c.relayTLS,
+		Proxy:  c.relayProxy,
+		Header: c.relayHeaders,
+	})
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
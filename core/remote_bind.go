@@ -0,0 +1,563 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/gzfly/network"
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/protocol/remotebind"
+	"github.com/go-zoox/gzfly/user"
+	"github.com/go-zoox/logger"
+	"github.com/go-zoox/packet/socksz"
+	"github.com/go-zoox/packet/socksz/base"
+	"github.com/go-zoox/packet/socksz/close"
+	"github.com/go-zoox/packet/socksz/handshake"
+	"github.com/go-zoox/random"
+	"github.com/go-zoox/zoox/components/application/websocket"
+)
+
+// RemoteBindTimeout is the max time waiting for the target to listen.
+const RemoteBindTimeout = 30 * time.Second
+
+// RemoteBind asks the target to listen on RemoteHost:RemotePort,
+// every accepted connection is tunneled back to LocalHost:LocalPort reachable from us, like ssh -R.
+type RemoteBind struct {
+	Network string
+	// listen on the target
+	RemoteHost string
+	RemotePort int
+	// reachable from us
+	LocalHost string
+	LocalPort int
+	//
+	Target *Target
+}
+
+// RemoteBindPolicy controls the listeners peers may open on this client by remote binds,
+// like GatewayPorts and PermitListen of sshd. The zero value only allows unprivileged
+// ports (1024+) on loopback hosts.
+type RemoteBindPolicy struct {
+	// GatewayPorts allows hosts other than loopback, such as 0.0.0.0 or empty (all addresses)
+	GatewayPorts bool
+	// PermitListen is the allowlist of listeners, replacing the unprivileged ports default.
+	// Entries are host:port, * matches any host or port, such as 127.0.0.1:8080, *:2222 or [::1]:*,
+	// or glob patterns of unix socket paths, such as /tmp/gzfly-*.sock
+	PermitListen []string
+}
+
+// Allows returns nil if peers may listen at host:port of network, or the reason why not.
+// Unix socket paths are only allowed by PermitListen.
+func (p *RemoteBindPolicy) Allows(network, host string, port int) error {
+	if p == nil {
+		p = &RemoteBindPolicy{}
+	}
+
+	if network == "unix" && isSocketPath(host) {
+		for _, pattern := range p.PermitListen {
+			if ok, _ := filepath.Match(pattern, host); ok && isSocketPath(pattern) {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("socket %s is not permitted", host)
+	}
+
+	if !p.GatewayPorts && !isLoopbackHost(host) {
+		return fmt.Errorf("host %s is not loopback, and gateway ports is disabled", formatAddress(host, port))
+	}
+
+	if len(p.PermitListen) == 0 {
+		if port != 0 && port < 1024 {
+			return fmt.Errorf("privileged port %d is not permitted", port)
+		}
+
+		return nil
+	}
+
+	for _, pattern := range p.PermitListen {
+		if isSocketPath(pattern) {
+			continue
+		}
+
+		patternHost, patternPort, err := net.SplitHostPort(pattern)
+		if err != nil {
+			continue
+		}
+
+		if patternHost != "*" && patternHost != host {
+			continue
+		}
+
+		if patternPort != "*" && patternPort != strconv.Itoa(port) {
+			continue
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("%s is not permitted", formatAddress(host, port))
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback ip, empty host is all addresses.
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// remoteBind is the remote bind requested by us.
+type remoteBind struct {
+	ID     string
+	Secret string
+	//
+	Config *RemoteBind
+	//
+	ResponseCh chan *remotebind.Response
+}
+
+// remoteBindPair is the remote bind recorded by the relay.
+type remoteBindPair struct {
+	*user.Pair
+	//
+	ID     string
+	Secret string
+}
+
+// remoteBindListener is the listener opened for the remote bind of peer.
+type remoteBindListener struct {
+	sync.Mutex
+	//
+	ID       string
+	listener io.Closer
+	closed   bool
+}
+
+func (l *remoteBindListener) Close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	l.closed = true
+	if l.listener == nil {
+		return nil
+	}
+
+	return l.listener.Close()
+}
+
+// RemoteBindServe asks the target to open the listener, it returns once the listener is ready.
+func (c *client) RemoteBindServe(cfg *RemoteBind) error {
+	logger.Info(
+		"[remote-bind] start to remote bind with target(%s): %s://%s:%d:%s:%d",
+		cfg.Target.UserClientID,
+		cfg.Network,
+		cfg.RemoteHost,
+		cfg.RemotePort,
+		cfg.LocalHost,
+		cfg.LocalPort,
+	)
+
+	// the network the target listens on, connections come back with the network of our endpoint
+	Network, err := getNetwork(getEndpointNetwork(cfg.Network, cfg.RemoteHost))
+	if err != nil {
+		return err
+	}
+
+	if !c.isOnline() {
+		return errors.New("agent is offline")
+	}
+
+	bind := &remoteBind{
+		ID:     socksz.GenerateID(),
+		Secret: random.String(32),
+		Config: cfg,
+		//
+		ResponseCh: make(chan *remotebind.Response, 1),
+	}
+	c.remoteBinds.Set(bind.ID, bind)
+
+	dataPacket := &remotebind.Request{
+		Secret: cfg.Target.UserPairKey,
+		//
+		BindID:             bind.ID,
+		SourceUserClientID: c.User.GetClientID(),
+		TargetUserClientID: cfg.Target.UserClientID,
+		Network:            Network,
+		Host:               cfg.RemoteHost,
+		Port:               uint16(cfg.RemotePort),
+		BindSecret:         bind.Secret,
+	}
+	data, err := dataPacket.Encode()
+	if err != nil {
+		c.remoteBinds.Remove(bind.ID)
+		return fmt.Errorf("failed to encode remote bind request: %v", err)
+	}
+
+	if err := c.writePacket(protocol.CommandRemoteBindRequest, data); err != nil {
+		c.remoteBinds.Remove(bind.ID)
+		return fmt.Errorf("failed to write packet: %v", err)
+	}
+
+	select {
+	case response := <-bind.ResponseCh:
+		if response.Status != STATUS_OK {
+			c.remoteBinds.Remove(bind.ID)
+			return fmt.Errorf("failed to remote bind(bind_id: %s), status: %d, message: %s", bind.ID, response.Status, response.Message)
+		}
+	case <-time.After(RemoteBindTimeout):
+		c.remoteBinds.Remove(bind.ID)
+		return fmt.Errorf("failed to wait remote bind(bind_id: %s): timeout", bind.ID)
+	}
+
+	logger.Info("[remote-bind][bind: %s] succeed to listen at %s://%s on target(%s)", bind.ID, cfg.Network, net.JoinHostPort(cfg.RemoteHost, fmt.Sprintf("%d", cfg.RemotePort)), cfg.Target.UserClientID)
+	return nil
+}
+
+// verifyRemoteBindHandshake verifies the handshake from the target of our remote bind,
+// whose DST.ADDR is the bind id, then points it to the destination of the bind.
+func (c *client) verifyRemoteBindHandshake(handshakePacket *handshake.Request) error {
+	bind, err := c.remoteBinds.Get(handshakePacket.DSTAddr)
+	if err != nil {
+		return fmt.Errorf("unknown remote bind(%s)", handshakePacket.DSTAddr)
+	}
+
+	if handshakePacket.TargetUserClientID != c.User.GetClientID() {
+		return fmt.Errorf("remote bind(%s) target mismatch", bind.ID)
+	}
+
+	handshakePacket.Secret = bind.Secret
+	if err := handshakePacket.Verify(); err != nil {
+		return err
+	}
+
+	Network, err := getNetwork(getEndpointNetwork(bind.Config.Network, bind.Config.LocalHost))
+	if err != nil {
+		return err
+	}
+
+	handshakePacket.Network = Network
+	handshakePacket.ATyp = getATyp(bind.Config.LocalHost)
+	handshakePacket.DSTAddr = bind.Config.LocalHost
+	handshakePacket.DSTPort = uint16(bind.Config.LocalPort)
+	return nil
+}
+
+// handleRemoteBindRequest opens the listener requested by peer.
+func (c *client) handleRemoteBindRequest(request *remotebind.Request) {
+	writeResponse := func(status uint8, err error) {
+		if status != STATUS_OK {
+			logger.Error("[remote-bind][bind: %s] failed to listen(status: %d): %v", request.BindID, status, err)
+		}
+
+		dataPacket := &remotebind.Response{
+			BindID: request.BindID,
+			Status: status,
+		}
+		if err != nil {
+			dataPacket.Message = err.Error()
+		}
+
+		data, err := dataPacket.Encode()
+		if err != nil {
+			logger.Error("[remote-bind][bind: %s] failed to encode response: %v", request.BindID, err)
+			return
+		}
+
+		if err := c.writePacket(protocol.CommandRemoteBindResponse, data); err != nil {
+			logger.Error("[remote-bind][bind: %s] failed to write response: %v", request.BindID, err)
+		}
+	}
+
+	request.Secret = c.User.PairKey
+	if err := request.Verify(); err != nil {
+		writeResponse(STATUS_INVALID_SIGNATURE, err)
+		return
+	}
+
+	Network, err := getNetworkName(request.Network)
+	if err != nil {
+		writeResponse(STATUS_FAILED_TO_LISTEN, err)
+		return
+	}
+
+	if err := c.remoteBindPolicy.Allows(Network, request.Host, int(request.Port)); err != nil {
+		writeResponse(STATUS_LISTEN_NOT_ALLOWED, err)
+		return
+	}
+
+	// connections go back to the source, signed with the bind secret
+	source := &Target{
+		UserClientID: request.SourceUserClientID,
+		UserPairKey:  request.BindSecret,
+	}
+
+	listener := &remoteBindListener{
+		ID: request.BindID,
+	}
+	c.remoteBindListeners.Set(request.BindID, listener)
+
+	logger.Info(
+		"[remote-bind][bind: %s] start to listen at %s://%s for %s",
+		request.BindID,
+		Network,
+		formatAddress(request.Host, int(request.Port)),
+		request.SourceUserClientID,
+	)
+
+	listened := false
+	go func() {
+		err := network.Serve(&network.ServeConfig{
+			Type: Network,
+			Host: request.Host,
+			Port: int(request.Port),
+			OnListen: func(l io.Closer) {
+				listener.Lock()
+				listener.listener = l
+				closed := listener.closed
+				listener.Unlock()
+
+				// closed before listening
+				if closed {
+					l.Close()
+					return
+				}
+
+				listened = true
+				writeResponse(STATUS_OK, nil)
+			},
+			OnConn: func() (net.Conn, error) {
+				wsConn, err := c.open(context.Background(), source, request.Network, request.BindID, 0)
+				if err != nil {
+					return nil, err
+				}
+
+				return wsConn, nil
+			},
+		})
+
+		c.remoteBindListeners.Remove(request.BindID)
+		if !listened {
+			writeResponse(STATUS_FAILED_TO_LISTEN, err)
+			return
+		}
+
+		logger.Info("[remote-bind][bind: %s] listener closed", request.BindID)
+	}()
+}
+
+// handleRemoteBindResponse wakes up RemoteBindServe waiting for the response.
+func (c *client) handleRemoteBindResponse(response *remotebind.Response) {
+	bind, err := c.remoteBinds.Get(response.BindID)
+	if err != nil {
+		logger.Errorf("[remote-bind][bind: %s] failed to get remote bind", response.BindID)
+		return
+	}
+
+	select {
+	case bind.ResponseCh <- response:
+	default:
+	}
+}
+
+// closeRemoteBind closes the remote bind, whichever side we are, returns false if id is not a remote bind.
+func (c *client) closeRemoteBind(id string) bool {
+	if listener, err := c.remoteBindListeners.Get(id); err == nil {
+		logger.Info("[remote-bind][bind: %s] closed by peer, stop listening", id)
+		c.remoteBindListeners.Remove(id)
+		if err := listener.Close(); err != nil {
+			logger.Errorf("[remote-bind][bind: %s] failed to close listener: %v", id, err)
+		}
+		return true
+	}
+
+	if _, err := c.remoteBinds.Get(id); err == nil {
+		logger.Warn("[remote-bind][bind: %s] closed by peer", id)
+		c.remoteBinds.Remove(id)
+		return true
+	}
+
+	return false
+}
+
+// closeRemoteBindListeners stops all listeners opened for peers, used when the relay link is lost.
+func (c *client) closeRemoteBindListeners() {
+	for _, id := range c.remoteBindListeners.Keys() {
+		c.closeRemoteBind(id)
+	}
+}
+
+// handleRemoteBindRequest verifies the remote bind request and forwards it to the target.
+func (s *server) handleRemoteBindRequest(currentUser *user.User, claims *TokenClaims, client *websocket.Client, packet *base.Base) {
+	request := &remotebind.Request{}
+	if err := request.Decode(packet.Data); err != nil {
+		logger.Error("[user: %s][remote-bind] failed to decode remote bind request packet: %v", currentUser.GetClientID(), err)
+		return
+	}
+
+	writeResponse := func(status uint8, err error) {
+		logger.Error("[user: %s][remote-bind][bind: %s] failed to remote bind(status: %d): %v", currentUser.GetClientID(), request.BindID, status, err)
+
+		dataPacket := &remotebind.Response{
+			BindID: request.BindID,
+			Status: status,
+		}
+		if err != nil {
+			dataPacket.Message = err.Error()
+		}
+
+		data, err := dataPacket.Encode()
+		if err != nil {
+			return
+		}
+
+		npacket := &base.Base{
+			Ver:    socksz.VER,
+			Cmd:    protocol.CommandRemoteBindResponse,
+			Data:   data,
+			Crypto: packet.Crypto,
+		}
+		if bytes, err := npacket.Encode(); err == nil {
+			client.WriteBinary(bytes)
+		}
+	}
+
+	if request.SourceUserClientID != currentUser.GetClientID() {
+		writeResponse(STATUS_INVALID_USER_CLIENT_ID, fmt.Errorf("source user(%s) mismatch", request.SourceUserClientID))
+		return
+	}
+
+	if !claims.Allows(request.TargetUserClientID) {
+		writeResponse(STATUS_TARGET_NOT_ALLOWED, fmt.Errorf("target %s is not allowed by token", request.TargetUserClientID))
+		return
+	}
+
+	targetUser, err := s.Users.Get(request.TargetUserClientID)
+	if err != nil {
+		writeResponse(STATUS_INVALID_USER_CLIENT_ID, err)
+		return
+	}
+
+	request.Secret = targetUser.PairKey
+	if err := request.Verify(); err != nil {
+		writeResponse(STATUS_FAILED_TO_PAIR, err)
+		return
+	}
+
+	if !targetUser.IsOnline() {
+		writeResponse(STATUS_USER_NOT_ONLINE, nil)
+		return
+	}
+
+	pair := &user.Pair{
+		Source: currentUser,
+		Target: targetUser,
+	}
+	s.RemoteBinds.Set(request.BindID, &remoteBindPair{
+		Pair:   pair,
+		ID:     request.BindID,
+		Secret: request.BindSecret,
+	})
+	// the response is routed back like connections
+	s.UserPairsByConnectionID.Set(request.BindID, pair)
+
+	logger.Infof(
+		"[user: %s][remote-bind][bind: %s] request target %s to listen at %s",
+		currentUser.GetClientID(),
+		request.BindID,
+		targetUser.GetClientID(),
+		formatAddress(request.Host, int(request.Port)),
+	)
+	if err := targetUser.WritePacket(packet); err != nil {
+		s.RemoteBinds.Remove(request.BindID)
+		s.UserPairsByConnectionID.Remove(request.BindID)
+		writeResponse(STATUS_FAILED_TO_HANDSHAKE, err)
+	}
+}
+
+// handleRemoteBindResponse routes the response back to the requester.
+func (s *server) handleRemoteBindResponse(currentUser *user.User, packet *base.Base) {
+	response := &remotebind.Response{}
+	if err := response.Decode(packet.Data); err != nil {
+		logger.Error("[user: %s][remote-bind] failed to decode remote bind response packet: %v", currentUser.GetClientID(), err)
+		return
+	}
+
+	bind, err := s.RemoteBinds.Get(response.BindID)
+	if err != nil || bind.Target != currentUser {
+		logger.Error("[user: %s][remote-bind][bind: %s] failed to get remote bind", currentUser.GetClientID(), response.BindID)
+		return
+	}
+
+	if response.Status != STATUS_OK {
+		s.RemoteBinds.Remove(response.BindID)
+		s.UserPairsByConnectionID.Remove(response.BindID)
+	}
+
+	if err := bind.Source.WritePacket(packet); err != nil {
+		logger.Error("[user: %s][remote-bind][bind: %s] failed to write response to %s: %v", currentUser.GetClientID(), response.BindID, bind.Source.GetClientID(), err)
+	}
+}
+
+// verifyRemoteBindHandshake verifies the handshake from the target of remote bind back to its source,
+// which is signed with the bind secret instead of the pair key.
+func (s *server) verifyRemoteBindHandshake(currentUser, targetUser *user.User, handshakePacket *handshake.Request) error {
+	bind, err := s.RemoteBinds.Get(handshakePacket.DSTAddr)
+	if err != nil {
+		return fmt.Errorf("unknown remote bind(%s)", handshakePacket.DSTAddr)
+	}
+
+	if bind.Source != targetUser || bind.Target != currentUser {
+		return fmt.Errorf("remote bind(%s) pair mismatch", bind.ID)
+	}
+
+	handshakePacket.Secret = bind.Secret
+	return handshakePacket.Verify()
+}
+
+// closeRemoteBinds drops the remote binds of the offline user, and notifies the peers.
+func (s *server) closeRemoteBinds(currentUser *user.User) {
+	for _, id := range s.RemoteBinds.Keys() {
+		bind, err := s.RemoteBinds.Get(id)
+		if err != nil {
+			continue
+		}
+
+		var peer *user.User
+		switch currentUser {
+		case bind.Source:
+			peer = bind.Target
+		case bind.Target:
+			peer = bind.Source
+		default:
+			continue
+		}
+
+		s.RemoteBinds.Remove(id)
+		s.UserPairsByConnectionID.Remove(id)
+
+		data, err := (&close.Close{ConnectionID: id}).Encode()
+		if err != nil {
+			continue
+		}
+
+		logger.Infof("[user: %s][remote-bind][bind: %s] close remote bind with %s", currentUser.GetClientID(), id, peer.GetClientID())
+		if err := peer.WritePacket(&base.Base{
+			Ver:  socksz.VER,
+			Cmd:  socksz.CommandClose,
+			Data: data,
+		}); err != nil {
+			logger.Warnf("[user: %s][remote-bind][bind: %s] failed to notify %s: %v", currentUser.GetClientID(), id, peer.GetClientID(), err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package core
+
+import "testing"
+
+func TestRemoteBindPolicyAllows(t *testing.T) {
+	cases := []struct {
+		name    string
+		policy  *RemoteBindPolicy
+		network string
+		host    string
+		port    int
+		allowed bool
+	}{
+		{"default loopback", nil, "tcp", "127.0.0.1", 8080, true},
+		{"default ipv6 loopback", nil, "tcp", "::1", 8080, true},
+		{"default localhost", nil, "udp", "localhost", 5353, true},
+		{"default any port", nil, "tcp", "127.0.0.1", 0, true},
+		{"default privileged", nil, "tcp", "127.0.0.1", 22, false},
+		{"default all addresses", nil, "tcp", "0.0.0.0", 8080, false},
+		{"default empty host", nil, "tcp", "", 8080, false},
+		{"default lan", nil, "tcp", "192.168.1.2", 8080, false},
+		{"default unix", nil, "unix", "/tmp/app.sock", 0, false},
+		{"unix with tcp host", nil, "unix", "127.0.0.1", 8080, true},
+		{"gateway ports", &RemoteBindPolicy{GatewayPorts: true}, "tcp", "0.0.0.0", 8080, true},
+		{"gateway ports privileged", &RemoteBindPolicy{GatewayPorts: true}, "tcp", "0.0.0.0", 22, false},
+		{"permit exact", &RemoteBindPolicy{PermitListen: []string{"127.0.0.1:22"}}, "tcp", "127.0.0.1", 22, true},
+		{"permit other port", &RemoteBindPolicy{PermitListen: []string{"127.0.0.1:22"}}, "tcp", "127.0.0.1", 8080, false},
+		{"permit any port", &RemoteBindPolicy{PermitListen: []string{"[::1]:*"}}, "tcp", "::1", 9000, true},
+		{"permit any host", &RemoteBindPolicy{PermitListen: []string{"*:2222"}}, "tcp", "localhost", 2222, true},
+		{"permit without gateway ports", &RemoteBindPolicy{PermitListen: []string{"0.0.0.0:8080"}}, "tcp", "0.0.0.0", 8080, false},
+		{"permit with gateway ports", &RemoteBindPolicy{GatewayPorts: true, PermitListen: []string{"0.0.0.0:8080"}}, "tcp", "0.0.0.0", 8080, true},
+		{"permit unix glob", &RemoteBindPolicy{PermitListen: []string{"/tmp/gzfly-*.sock"}}, "unix", "/tmp/gzfly-app.sock", 0, true},
+		{"permit unix other", &RemoteBindPolicy{PermitListen: []string{"/tmp/gzfly-*.sock"}}, "unix", "/var/run/docker.sock", 0, false},
+	}
+
+	for _, c := range cases {
+		err := c.policy.Allows(c.network, c.host, c.port)
+		if c.allowed && err != nil {
+			t.Errorf("%s: want allowed, got %v", c.name, err)
+		}
+		if !c.allowed && err == nil {
+			t.Errorf("%s: want rejected", c.name)
+		}
+	}
+}
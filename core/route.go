@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/go-zoox/gzfly/router"
+	"github.com/go-zoox/logger"
+	"github.com/go-zoox/packet/socksz/handshake"
+)
+
+// dialByRules connects to host:port by the rule matched in r, which dials directly,
+// rejects or uses a named target; target is used if r is nil or no rule matches.
+//
+// name is the name of the caller used in logs, such as socks5.
+func (c *client) dialByRules(name string, r *router.Router, targets map[string]*Target, target *Target, source string, host string, port int) (net.Conn, error) {
+	address := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+
+	if r != nil {
+		action := router.ActionPeer
+		if rule := r.Match(host, port); rule != nil {
+			logger.Infof("[%s][rule: %s (line %d)] %s => %s", name, rule, rule.Line, source, address)
+			action = rule.Action
+		}
+
+		switch action {
+		case router.ActionDirect:
+			// same as targets requested by peers, with dial options and egress proxies
+			options, err := c.egressDialOptions("tcp", host, port)
+			if err != nil {
+				return nil, fmt.Errorf("[%s] %v", name, err)
+			}
+
+			return options.Dial("tcp", address)
+		case router.ActionReject:
+			return nil, fmt.Errorf("[%s] %s is rejected by rules", name, address)
+		case router.ActionPeer:
+		default:
+			t, ok := targets[action]
+			if !ok {
+				return nil, fmt.Errorf("[%s] unknown target(%s) in rules", name, action)
+			}
+			target = t
+		}
+	}
+
+	targetConn, err := c.open(context.Background(), target, handshake.NetworkTCP, host, port)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %v", name, err)
+	}
+
+	return targetConn, nil
+}
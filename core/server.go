@@ -1,12 +1,16 @@
 package core
 
 import (
+	"crypto/x509"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/go-zoox/gzfly/connection"
 	"github.com/go-zoox/gzfly/manager"
 	"github.com/go-zoox/gzfly/network/tcp"
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/protocol/token"
 	"github.com/go-zoox/gzfly/user"
 	"github.com/go-zoox/logger"
 	"github.com/go-zoox/packet/socksz"
@@ -18,6 +22,7 @@ import (
 	"github.com/go-zoox/zoox"
 	"github.com/go-zoox/zoox/components/application/websocket"
 	defaults "github.com/go-zoox/zoox/defaults"
+	gowebsocket "github.com/gorilla/websocket"
 )
 
 type Server interface {
@@ -34,9 +39,19 @@ type server struct {
 	// connections *manager.Manager[*connection.WSConn]
 	Users                   *manager.Manager[*user.User]
 	UserPairsByConnectionID *manager.Manager[*user.Pair]
+	RemoteBinds             *manager.Manager[*remoteBindPair]
 
 	// listener
 	OnConnect func(conn net.Conn, source, target string)
+
+	// Transports are listened besides the websocket, with the certificate of TLS
+	Transports []string
+	TLS        ServerTLS
+
+	// PeerOffers routes answers of direct link offers back to their sources
+	PeerOffers *manager.Manager[*user.Pair]
+
+	Token ServerToken
 }
 
 type ServerConfig struct {
@@ -44,6 +59,12 @@ type ServerConfig struct {
 	Path  string            `config:"path"`
 	Users []user.UserClient `config:"clients"`
 	Admin user.UserClient   `config:"admin"`
+	// Transports are listeners of links besides the websocket at Port,
+	// such as tls://:6443, h2://:8443 and quic://:6443, all require the certificate of TLS
+	Transports []string  `config:"transports"`
+	TLS        ServerTLS `config:"tls"`
+	// Token enables authentication by tokens, see IssueToken
+	Token ServerToken `config:"token"`
 	//
 	UserPairsByConnectionID *manager.Manager[*user.Pair]
 	OnConnect               func(conn net.Conn, source, target string)
@@ -68,7 +89,9 @@ func NewServer(cfg *ServerConfig) Server {
 	}
 	if cfg.Users != nil {
 		for _, u := range cfg.Users {
-			Users.Set(u.ClientID, user.New(u.ClientID, u.ClientSecret, u.PairKey))
+			user := user.New(u.ClientID, u.ClientSecret, u.PairKey)
+			user.CertSubject = u.CertSubject
+			Users.Set(u.ClientID, user)
 		}
 	}
 	if cfg.UserPairsByConnectionID != nil {
@@ -84,7 +107,15 @@ func NewServer(cfg *ServerConfig) Server {
 		Users,
 		//
 		UserPairsByConnectionID,
+		manager.New[*remoteBindPair](),
 		OnConnect,
+		//
+		cfg.Transports,
+		cfg.TLS,
+		//
+		manager.New[*user.Pair](),
+		//
+		cfg.Token,
 	}
 }
 
@@ -99,212 +130,347 @@ func (s *server) Run() error {
 	// s.Users.Set("id_04aba01", user.New("id_04aba01", "29f4e3d3a4302b4d9e01", "pair_3fd01"))
 	// s.Users.Set("id_04aba02", user.New("id_04aba02", "29f4e3d3a4302b4d9e02", "pair_3fd02"))
 
-	core.WebSocket(s.Path, func(ctx *zoox.Context, client *websocket.Client) {
-		// @TODO
-		isAuthenticated := false
-		userClientID := ""
-		var currentUser *user.User
+	// messages of one link are handled in order, so that frames of a connection,
+	// such as forward followed by close, are never reordered
+	core.WebSocketGorilla(s.Path, func(ctx *zoox.Context, conn *websocket.GorillaConn) {
+		// links of the same session (websocket query: session) are one client
+		s.handleLink(ctx.Logger, websocket.New(conn), ctx.Query().Get("session").String(), nil)
+	})
 
-		client.OnError = func(err error) {
-			if e, ok := err.(*websocket.CloseError); ok {
-				ctx.Logger.Error("[error][client: %s][code: %d] %v", client.ID, e.Code, e)
-			} else {
-				ctx.Logger.Error("[error][client: %s][code: nocode] %v", client.ID, err)
-			}
+	if err := s.listenTransports(); err != nil {
+		return err
+	}
+
+	return core.Run(fmt.Sprintf(":%d", s.Port))
+}
+
+// handleLink serves one link of client, accepted by websocket or any of transports,
+// cert is the verified client certificate of the link, if any.
+func (s *server) handleLink(log *logger.Logger, client *websocket.Client, session string, cert *x509.Certificate) {
+	// @TODO
+	isAuthenticated := false
+	userClientID := ""
+	var currentUser *user.User
+	link := &connection.WSClient{Client: client}
+	// claims of the token authenticated with, nil if by secret or certificate
+	var claims *TokenClaims
+	var tokenTimer *time.Timer
+
+	client.OnError = func(err error) {
+		if e, ok := err.(*websocket.CloseError); ok {
+			log.Error("[error][client: %s][code: %d] %v", client.ID, e.Code, e)
+		} else {
+			log.Error("[error][client: %s][code: nocode] %v", client.ID, err)
 		}
+	}
+
+	client.OnConnect = func() {
+		log.Info("[connect] client: %s", client.ID)
+	}
 
-		client.OnConnect = func() {
-			ctx.Logger.Info("[connect] client: %s", client.ID)
+	client.OnDisconnect = func() {
+		if tokenTimer != nil {
+			tokenTimer.Stop()
 		}
 
-		client.OnDisconnect = func() {
-			if !isAuthenticated {
-				ctx.Logger.Info("[disconnect] (user: anonymouse, client: %s) offline", client.ID)
-			}
+		if !isAuthenticated {
+			log.Info("[disconnect] (user: anonymouse, client: %s) offline", client.ID)
+			return
+		}
 
-			if !currentUser.IsOnline() {
-				return
-			}
+		left, dropped := currentUser.Leave(link)
+		s.abortConnections(currentUser, dropped)
+		if left != 0 {
+			log.Info("[disconnect] (user: %s, client: %s) link closed, %d links left", currentUser.ClientID, client.ID, left)
+			return
+		}
+
+		log.Info("[disconnect] (user: %s, client: %s) offline", currentUser.ClientID, client.ID)
+		s.closeRemoteBinds(currentUser)
+	}
 
-			ctx.Logger.Info("[disconnect] (user: %s, client: %s) offline", currentUser.ClientID, client.ID)
-			currentUser.SetOffline()
+	client.OnBinaryMessage = func(raw []byte) {
+		packet := &base.Base{}
+		err := packet.Decode(raw)
+		if err != nil {
+			log.Error("invalid packet: %v", err)
+			return
 		}
 
-		client.OnBinaryMessage = func(raw []byte) {
-			packet := &base.Base{}
-			err := packet.Decode(raw)
+		if !isAuthenticated && packet.Cmd != socksz.CommandAuthenticate && packet.Cmd != protocol.CommandAuthenticateToken {
+			log.Error("client must authenticate before send command(%d)", packet.Cmd)
+			return
+		}
+
+		switch packet.Cmd {
+		case socksz.CommandAuthenticate:
+			// decode
+			authenticatePacket := &authenticate.Request{}
+			err := authenticatePacket.Decode(packet.Data)
 			if err != nil {
-				ctx.Logger.Error("invalid packet: %v", err)
+				log.Error("failed to decode authenticate request packet: %v", err)
 				return
 			}
 
-			if !isAuthenticated && packet.Cmd != socksz.CommandAuthenticate {
-				ctx.Logger.Error("client must authenticate before send command(%d)", packet.Cmd)
-				return
-			}
+			writeResponse := func(status uint8, err error) error {
+				if status != STATUS_OK {
+					log.Error("[user: %s] failed to connect(status: %d): %v", authenticatePacket.UserClientID, status, err)
+				}
 
-			switch packet.Cmd {
-			case socksz.CommandAuthenticate:
-				// decode
-				authenticatePacket := &authenticate.Request{}
-				err := authenticatePacket.Decode(packet.Data)
+				dataPacket := &authenticate.Response{
+					Status: status,
+				}
 				if err != nil {
-					ctx.Logger.Error("failed to decode authenticate request packet: %v", err)
-					return
+					dataPacket.Message = err.Error()
 				}
 
-				writeResponse := func(status uint8, err error) error {
-					if status != STATUS_OK {
-						ctx.Logger.Error("[user: %s] failed to connect(status: %d): %v", authenticatePacket.UserClientID, status, err)
-					}
-
-					dataPacket := &authenticate.Response{
-						Status: status,
-					}
-					if err != nil {
-						dataPacket.Message = err.Error()
-					}
-
-					dataBytes, err := dataPacket.Encode()
-					if err != nil {
-						return fmt.Errorf("failed to encode authenticate response: %v", err)
-					}
+				dataBytes, err := dataPacket.Encode()
+				if err != nil {
+					return fmt.Errorf("failed to encode authenticate response: %v", err)
+				}
 
-					npacket := &base.Base{
-						Ver:  socksz.VER,
-						Cmd:  socksz.CommandAuthenticate,
-						Data: dataBytes,
-						//
-						Crypto: packet.Crypto,
-					}
-					if bytes, err := npacket.Encode(); err != nil {
-						return fmt.Errorf("failed to encode packet %v", err)
-					} else {
-						return client.WriteBinary(bytes)
-					}
+				npacket := &base.Base{
+					Ver:  socksz.VER,
+					Cmd:  socksz.CommandAuthenticate,
+					Data: dataBytes,
+					//
+					Crypto: packet.Crypto,
 				}
+				if bytes, err := npacket.Encode(); err != nil {
+					return fmt.Errorf("failed to encode packet %v", err)
+				} else {
+					return client.WriteBinary(bytes)
+				}
+			}
 
-				ctx.Logger.Info("[user: %s][authenticate] start to authenticated", authenticatePacket.UserClientID)
+			log.Info("[user: %s][authenticate] start to authenticated", authenticatePacket.UserClientID)
 
-				user, err := s.Users.Get(authenticatePacket.UserClientID)
-				if err != nil {
-					writeResponse(STATUS_INVALID_USER_CLIENT_ID, err)
-					return
-				}
-				authenticatePacket.Secret = user.ClientSecret
+			user, err := s.Users.Get(authenticatePacket.UserClientID)
+			if err != nil {
+				writeResponse(STATUS_INVALID_USER_CLIENT_ID, err)
+				return
+			}
+			authenticatePacket.Secret = user.ClientSecret
 
+			// the certificate identifies the user instead of the secret, unless both are required
+			if cert != nil && !user.MatchCertificate(cert) {
+				writeResponse(STATUS_INVALID_USER_CLIENT_ID, fmt.Errorf("client certificate(%s) is not of the user", cert.Subject))
+				return
+			}
+			if cert == nil || s.TLS.RequireSecret {
 				if err := authenticatePacket.Verify(); err != nil {
 					writeResponse(STATUS_INVALID_SIGNATURE, err)
 					return
 				}
+			}
 
-				// @TODO
-				isAuthenticated = true
-				userClientID = authenticatePacket.UserClientID
-				currentUser = user
-				if err := user.SetOnline(&connection.WSClient{Client: client}); err != nil {
-					writeResponse(STATUS_FAILED_TO_SET_USER_ONELINE, err)
-					return
-				}
+			if err := user.Join(session, link); err != nil {
+				writeResponse(STATUS_FAILED_TO_SET_USER_ONELINE, err)
+				return
+			}
 
-				writeResponse(STATUS_OK, nil)
-				ctx.Logger.Info("[user: %s][authenticate] succeed to authenticate", userClientID)
+			// @TODO
+			isAuthenticated = true
+			userClientID = authenticatePacket.UserClientID
+			currentUser = user
+
+			writeResponse(STATUS_OK, nil)
+			log.Info("[user: %s][authenticate] succeed to authenticate (links: %d)", userClientID, user.Links())
+			return
+		case protocol.CommandAuthenticateToken:
+			tokenPacket := &token.Request{}
+			if err := tokenPacket.Decode(packet.Data); err != nil {
+				log.Error("failed to decode authenticate token request packet: %v", err)
 				return
-			case socksz.CommandHandshakeRequest:
-				handshakePacket := handshake.Request{}
-				err := handshakePacket.Decode(packet.Data)
+			}
+
+			writeResponse := func(status uint8, err error) error {
+				if status != STATUS_OK {
+					log.Error("[user: %s] failed to connect by token(status: %d): %v", tokenPacket.UserClientID, status, err)
+				}
+
+				dataPacket := &authenticate.Response{
+					Status: status,
+				}
 				if err != nil {
-					ctx.Logger.Error("failed to decode handshake request packet: %v", err)
-					return
+					dataPacket.Message = err.Error()
 				}
 
-				Network := "tcp"
-				switch handshakePacket.Network {
-				case handshake.NetworkTCP:
-					Network = "tcp"
-				case handshake.NetworkUDP:
-					Network = "udp"
-				default:
-					logger.Errorf("unknown network type: %d, only support 0x01(tcp)/0x02(udp)", handshakePacket.Network)
-					return
+				dataBytes, err := dataPacket.Encode()
+				if err != nil {
+					return fmt.Errorf("failed to encode authenticate response: %v", err)
 				}
 
-				writeResponse := func(status uint8, err error) error {
-					if status != STATUS_OK {
-						ctx.Logger.Error("[connection: %s] failed to handshake(status: %d): %v", handshakePacket.ConnectionID, status, err)
-					}
+				npacket := &base.Base{
+					Ver:  socksz.VER,
+					Cmd:  socksz.CommandAuthenticate,
+					Data: dataBytes,
+					//
+					Crypto: packet.Crypto,
+				}
+				if bytes, err := npacket.Encode(); err != nil {
+					return fmt.Errorf("failed to encode packet %v", err)
+				} else {
+					return client.WriteBinary(bytes)
+				}
+			}
 
-					dataPacket := &handshake.Response{
-						ConnectionID: handshakePacket.ConnectionID,
-						Status:       status,
-					}
-					if err != nil {
-						dataPacket.Message = err.Error()
-					}
+			if s.Token.Secret == "" {
+				writeResponse(STATUS_INVALID_SIGNATURE, fmt.Errorf("token is not supported by the relay"))
+				return
+			}
 
-					dataBytes, err := dataPacket.Encode()
-					if err != nil {
-						return fmt.Errorf("failed to encode handshake response: %v", err)
-					}
+			// crypto is keyed by the client secret, which token sessions do not hold
+			if packet.Crypto != 0 {
+				writeResponse(STATUS_CRYPTO_NOT_ALLOWED, fmt.Errorf("crypto is not supported by token sessions, use a tls transport instead"))
+				return
+			}
 
-					npacket := &base.Base{
-						Ver:    socksz.VER,
-						Cmd:    socksz.CommandHandshakeResponse,
-						Data:   dataBytes,
-						Crypto: packet.Crypto,
-					}
-					if bytes, err := npacket.Encode(); err != nil {
-						return fmt.Errorf("failed to encode packet %v", err)
-					} else {
-						return client.WriteBinary(bytes)
-					}
+			tokenClaims, err := VerifyToken(s.Token.Secret, s.Token.Audience, tokenPacket.Token)
+			if err == ErrTokenExpired {
+				writeResponse(STATUS_TOKEN_EXPIRED, err)
+				return
+			} else if err != nil {
+				writeResponse(STATUS_INVALID_SIGNATURE, err)
+				return
+			}
+
+			if tokenClaims.UserClientID != tokenPacket.UserClientID {
+				writeResponse(STATUS_INVALID_USER_CLIENT_ID, fmt.Errorf("token is of user %s", tokenClaims.UserClientID))
+				return
+			}
+
+			user, err := s.Users.Get(tokenClaims.UserClientID)
+			if err != nil {
+				writeResponse(STATUS_INVALID_USER_CLIENT_ID, err)
+				return
+			}
+
+			if cert != nil && !user.MatchCertificate(cert) {
+				writeResponse(STATUS_INVALID_USER_CLIENT_ID, fmt.Errorf("client certificate(%s) is not of the user", cert.Subject))
+				return
+			}
+
+			if err := user.JoinByToken(session, link); err != nil {
+				writeResponse(STATUS_FAILED_TO_SET_USER_ONELINE, err)
+				return
+			}
+
+			isAuthenticated = true
+			userClientID = tokenClaims.UserClientID
+			currentUser = user
+			claims = tokenClaims
+
+			// the session ends with the token, links are closed then
+			tokenTimer = time.AfterFunc(time.Until(tokenClaims.ExpiresAt), func() {
+				log.Info("[user: %s][authenticate] token expired, disconnect", userClientID)
+				client.Disconnect()
+			})
+
+			writeResponse(STATUS_OK, nil)
+			log.Info("[user: %s][authenticate] succeed to authenticate by token (expires at: %s, links: %d)", userClientID, tokenClaims.ExpiresAt.Format(time.RFC3339), user.Links())
+			return
+		case socksz.CommandHandshakeRequest:
+			handshakePacket := handshake.Request{}
+			err := handshakePacket.Decode(packet.Data)
+			if err != nil {
+				log.Error("failed to decode handshake request packet: %v", err)
+				return
+			}
+
+			// custom networks of clients may be unknown here, the name is only for logs
+			Network, err := getNetworkName(handshakePacket.Network)
+			if err != nil {
+				Network = fmt.Sprintf("0x%02x", handshakePacket.Network)
+			}
+
+			writeResponse := func(status uint8, err error) error {
+				if status != STATUS_OK {
+					log.Error("[connection: %s] failed to handshake(status: %d): %v", handshakePacket.ConnectionID, status, err)
 				}
 
-				logger.Infof(
-					"[user: %s][handshake][connection: %s] start to check target user(%s) ...",
-					userClientID,
-					handshakePacket.ConnectionID,
-					handshakePacket.TargetUserClientID,
-				)
-				targetUser, err := s.Users.Get(handshakePacket.TargetUserClientID)
+				dataPacket := &handshake.Response{
+					ConnectionID: handshakePacket.ConnectionID,
+					Status:       status,
+				}
 				if err != nil {
-					writeResponse(STATUS_INVALID_USER_CLIENT_ID, err)
-					return
+					dataPacket.Message = err.Error()
 				}
 
-				handshakePacket.Secret = targetUser.PairKey
-				err = handshakePacket.Verify()
+				dataBytes, err := dataPacket.Encode()
 				if err != nil {
-					ctx.Logger.Error("invalid handshake request packet: %v - %s", err)
-					return
+					return fmt.Errorf("failed to encode handshake response: %v", err)
 				}
 
-				logger.Infof(
-					"[user: %s][handshake][connection: %s] start to check online(user: %s) ...",
-					userClientID,
-					handshakePacket.ConnectionID,
-					handshakePacket.TargetUserClientID,
-				)
-				if !targetUser.IsOnline() {
-					writeResponse(STATUS_USER_NOT_ONLINE, nil)
+				npacket := &base.Base{
+					Ver:    socksz.VER,
+					Cmd:    socksz.CommandHandshakeResponse,
+					Data:   dataBytes,
+					Crypto: packet.Crypto,
+				}
+				if bytes, err := npacket.Encode(); err != nil {
+					return fmt.Errorf("failed to encode packet %v", err)
+				} else {
+					return client.WriteBinary(bytes)
+				}
+			}
+
+			logger.Infof(
+				"[user: %s][handshake][connection: %s] start to check target user(%s) ...",
+				userClientID,
+				handshakePacket.ConnectionID,
+				handshakePacket.TargetUserClientID,
+			)
+			if !claims.Allows(handshakePacket.TargetUserClientID) {
+				writeResponse(STATUS_TARGET_NOT_ALLOWED, fmt.Errorf("target %s is not allowed by token", handshakePacket.TargetUserClientID))
+				return
+			}
+
+			targetUser, err := s.Users.Get(handshakePacket.TargetUserClientID)
+			if err != nil {
+				writeResponse(STATUS_INVALID_USER_CLIENT_ID, err)
+				return
+			}
+
+			isRemoteBind := false
+			handshakePacket.Secret = targetUser.PairKey
+			err = handshakePacket.Verify()
+			if err != nil {
+				// connections accepted by remote binds are signed with the bind secret
+				if errx := s.verifyRemoteBindHandshake(currentUser, targetUser, &handshakePacket); errx != nil {
+					writeResponse(STATUS_INVALID_SIGNATURE, err)
 					return
 				}
 
-				logger.Infof(
-					"[user: %s][handshake][connection: %s] request target %s at %s://%s:%d",
-					userClientID,
-					handshakePacket.ConnectionID,
-					targetUser.GetClientID(),
-					Network,
-					handshakePacket.DSTAddr,
-					handshakePacket.DSTPort,
-				)
+				isRemoteBind = true
+			}
 
-				logger.Infof(
-					"[user: %s][handshake][connection: %s] start to pair",
-					userClientID,
-					handshakePacket.ConnectionID,
-				)
+			logger.Infof(
+				"[user: %s][handshake][connection: %s] start to check online(user: %s) ...",
+				userClientID,
+				handshakePacket.ConnectionID,
+				handshakePacket.TargetUserClientID,
+			)
+			if !targetUser.IsOnline() {
+				writeResponse(STATUS_USER_NOT_ONLINE, nil)
+				return
+			}
+
+			logger.Infof(
+				"[user: %s][handshake][connection: %s] request target %s at %s://%s",
+				userClientID,
+				handshakePacket.ConnectionID,
+				targetUser.GetClientID(),
+				Network,
+				formatAddress(handshakePacket.DSTAddr, int(handshakePacket.DSTPort)),
+			)
+
+			logger.Infof(
+				"[user: %s][handshake][connection: %s] start to pair",
+				userClientID,
+				handshakePacket.ConnectionID,
+			)
+			if !isRemoteBind {
 				ok, err := targetUser.Pair(
 					handshakePacket.ConnectionID,
 					handshakePacket.TargetUserClientID,
@@ -314,313 +480,394 @@ func (s *server) Run() error {
 					writeResponse(STATUS_FAILED_TO_PAIR, err)
 					return
 				}
+			}
+
+			logger.Infof(
+				"[user: %s][handshake][connection: %s] write packet to %s",
+				userClientID,
+				handshakePacket.ConnectionID,
+				targetUser.GetClientID(),
+			)
+			request := *packet
+			// the target encrypts the connection as requested, token sessions cannot
+			if targetUser.ByToken() {
+				request.Crypto = 0
+			}
+			// frames of the connection keep to the link of source it came from, and one link of target
+			targetUser.Pin(handshakePacket.ConnectionID, nil)
+			if err := targetUser.WritePacketTo(handshakePacket.ConnectionID, &request); err != nil {
+				targetUser.Release(handshakePacket.ConnectionID)
+				writeResponse(STATUS_FAILED_TO_HANDSHAKE, err)
+				return
+			}
 
-				logger.Infof(
-					"[user: %s][handshake][connection: %s] write packet to %s",
+			currentUser.Pin(handshakePacket.ConnectionID, link)
+			s.UserPairsByConnectionID.Set(handshakePacket.ConnectionID, &user.Pair{
+				Source: currentUser,
+				Target: targetUser,
+			})
+			writeResponse(STATUS_OK, nil)
+			return
+		// case socksz.COMMAND_BIND:
+		// 	go func() {
+		// 		if err := CreateTCPServer(&CreateTCPServerConfig{
+		// 			Port: 8888,
+		// 			OnConn: func() (net.Conn, error) {
+		// 				id := connection.GenerateID()
+		// 				wsConn := connection.New(id, client)
+		// 				wsConnsManager.Set(id, wsConn)
+		// 				return wsConn, nil
+		// 			},
+		// 		}); err != nil {
+
+		// 		}
+		// 	}()
+		// case socksz.COMMAND_CONNECT:
+		// 	data := packet.Data
+		// 	id, err := connection.DecodeID(data)
+		// 	if err != nil {
+		// 		fmt.Print("[connect] failed to parse id:", err)
+		// 		return
+		// 	}
+
+		// 	wsconn, err := wsConnsManager.Get(id)
+		// 	if err != nil {
+		// 		fmt.Println("[connect] failed to get conn:", err)
+		// 		return
+		// 	}
+
+		// 	wsconn.Stream <- data
+		case socksz.CommandForward:
+			// fmt.Println("forward aes:", packet.Crypto)
+
+			closeSelfConnection := func(ConnectionID string) {
+				log.Info(
+					"[user: %s][forward][connection: %s] close self connection",
 					userClientID,
-					handshakePacket.ConnectionID,
-					targetUser.GetClientID(),
+					ConnectionID,
 				)
-				if err := targetUser.WritePacket(packet); err != nil {
-					writeResponse(STATUS_FAILED_TO_HANDSHAKE, err)
-					return
+				closePacket := &close.Close{
+					ConnectionID: ConnectionID,
 				}
-
-				s.UserPairsByConnectionID.Set(handshakePacket.ConnectionID, &user.Pair{
-					Source: currentUser,
-					Target: targetUser,
-				})
-				writeResponse(STATUS_OK, nil)
-				return
-			// case socksz.COMMAND_BIND:
-			// 	go func() {
-			// 		if err := CreateTCPServer(&CreateTCPServerConfig{
-			// 			Port: 8888,
-			// 			OnConn: func() (net.Conn, error) {
-			// 				id := connection.GenerateID()
-			// 				wsConn := connection.New(id, client)
-			// 				wsConnsManager.Set(id, wsConn)
-			// 				return wsConn, nil
-			// 			},
-			// 		}); err != nil {
-
-			// 		}
-			// 	}()
-			// case socksz.COMMAND_CONNECT:
-			// 	data := packet.Data
-			// 	id, err := connection.DecodeID(data)
-			// 	if err != nil {
-			// 		fmt.Print("[connect] failed to parse id:", err)
-			// 		return
-			// 	}
-
-			// 	wsconn, err := wsConnsManager.Get(id)
-			// 	if err != nil {
-			// 		fmt.Println("[connect] failed to get conn:", err)
-			// 		return
-			// 	}
-
-			// 	wsconn.Stream <- data
-			case socksz.CommandForward:
-				// fmt.Println("forward aes:", packet.Crypto)
-
-				closeSelfConnection := func(ConnectionID string) {
-					ctx.Logger.Info(
-						"[user: %s][forward][connection: %s] close self connection",
+				if dataBytes, err := closePacket.Encode(); err != nil {
+					log.Error(
+						"[user: %s][forward][connection: %s] failed to encode close data: %v",
 						userClientID,
 						ConnectionID,
+						err,
 					)
-					closePacket := &close.Close{
-						ConnectionID: ConnectionID,
+				} else {
+					npacket := &base.Base{
+						Ver:    socksz.VER,
+						Cmd:    socksz.CommandClose,
+						Data:   dataBytes,
+						Crypto: packet.Crypto,
 					}
-					if dataBytes, err := closePacket.Encode(); err != nil {
-						ctx.Logger.Error(
-							"[user: %s][forward][connection: %s] failed to encode close data: %v",
+					if bytes, err := npacket.Encode(); err != nil {
+						log.Error(
+							"[user: %s][forward][connection: %s] failed to encode close packet: %v",
 							userClientID,
 							ConnectionID,
 							err,
 						)
 					} else {
-						npacket := &base.Base{
-							Ver:    socksz.VER,
-							Cmd:    socksz.CommandClose,
-							Data:   dataBytes,
-							Crypto: packet.Crypto,
-						}
-						if bytes, err := npacket.Encode(); err != nil {
-							ctx.Logger.Error(
-								"[user: %s][forward][connection: %s] failed to encode close packet: %v",
+						if err := client.WriteBinary(bytes); err != nil {
+							log.Error(
+								"[user: %s][close][connection: %s] failed to write close self connection: %v",
 								userClientID,
-								ConnectionID,
+								closePacket.ConnectionID,
 								err,
 							)
-						} else {
-							if err := client.WriteBinary(bytes); err != nil {
-								ctx.Logger.Error(
-									"[user: %s][close][connection: %s] failed to write close self connection: %v",
-									userClientID,
-									closePacket.ConnectionID,
-									err,
-								)
-							}
 						}
 					}
 				}
+			}
 
-				forwardPacket := &forward.Forward{
-					Crypto: packet.Crypto,
-					Secret: currentUser.ClientSecret,
-				}
-				err := forwardPacket.Decode(packet.Data)
-				if err != nil {
-					ctx.Logger.Error(
-						"[user: %s][forward][connection: %s] failed to decode forward request packet: %v",
-						userClientID,
-						forwardPacket.ConnectionID,
-						err,
-					)
-					return
-				}
+			// token sessions have no crypto, see ServerToken
+			if claims != nil && packet.Crypto != 0 {
+				log.Error("[user: %s][forward] drop encrypted packet of token session", userClientID)
+				return
+			}
 
-				logger.Debugf(
-					"[user: %s][forward][connection: %s] start to check user pair ...",
+			forwardPacket := &forward.Forward{
+				Crypto: packet.Crypto,
+				Secret: currentUser.ClientSecret,
+			}
+			err := forwardPacket.Decode(packet.Data)
+			if err != nil {
+				log.Error(
+					"[user: %s][forward][connection: %s] failed to decode forward request packet: %v",
 					userClientID,
 					forwardPacket.ConnectionID,
+					err,
 				)
-				userPair, err := s.UserPairsByConnectionID.Get(forwardPacket.ConnectionID)
-				if err != nil {
-					ctx.Logger.Error(
-						"[user: %s][forward][connection: %s] failed to get target user: %v",
-						userClientID,
-						forwardPacket.ConnectionID,
-						err,
-					)
-
-					// close self connection
-					closeSelfConnection(forwardPacket.ConnectionID)
-					return
-				}
-
-				var targetUser *user.User
-				if currentUser.GetClientID() == userPair.Source.GetClientID() {
-					targetUser = userPair.Target
-				} else {
-					targetUser = userPair.Source
-				}
+				return
+			}
 
-				logger.Debugf(
-					"[user: %s][forward][connection: %s] start to forward to target user(%s)",
-					currentUser.GetClientID(),
+			logger.Debugf(
+				"[user: %s][forward][connection: %s] start to check user pair ...",
+				userClientID,
+				forwardPacket.ConnectionID,
+			)
+			userPair, err := s.UserPairsByConnectionID.Get(forwardPacket.ConnectionID)
+			if err != nil {
+				log.Error(
+					"[user: %s][forward][connection: %s] failed to get target user: %v",
+					userClientID,
 					forwardPacket.ConnectionID,
-					targetUser.GetClientID(),
+					err,
 				)
-				// if err := targetUser.WritePacket(packet); err != nil {
-				// 	ctx.Logger.Error(
-				// 		"[user: %s][forward][connection: %s] failed to write packet: %v",
-				// 		userClientID,
-				// 		forwardPacket.ConnectionID,
-				// 		err,
-				// 	)
-				// 	return
-				// }
-
-				forwardPacket.Crypto = packet.Crypto
-				forwardPacket.Secret = targetUser.ClientSecret
-				forwardBytes, err := forwardPacket.Encode()
-				if err != nil {
-					ctx.Logger.Error(
-						"[user: %s][forward][connection: %s] failed to encode forward request packet: %v",
-						userClientID,
-						forwardPacket.ConnectionID,
-						err,
-					)
-					return
-				}
-
-				packet.Data = forwardBytes
-				cipher, err := packet.Encode()
-				if err != nil {
-					ctx.Logger.Error(
-						"[user: %s][forward][connection: %s] failed to encode request packet: %v",
-						userClientID,
-						forwardPacket.ConnectionID,
-						err,
-					)
-					return
-				}
 
-				if err := targetUser.WriteBytes(cipher); err != nil {
-					ctx.Logger.Error(
-						"[user: %s][forward][connection: %s] failed to write packet: %v",
-						userClientID,
-						forwardPacket.ConnectionID,
-						err,
-					)
+				// close self connection
+				closeSelfConnection(forwardPacket.ConnectionID)
+				return
+			}
 
-					// close self connection
-					closeSelfConnection(forwardPacket.ConnectionID)
-					return
-				}
+			var targetUser *user.User
+			if currentUser.GetClientID() == userPair.Source.GetClientID() {
+				targetUser = userPair.Target
+			} else {
+				targetUser = userPair.Source
+			}
 
-				logger.Debugf(
-					"[user: %s][forward][connection: %s] succeed to forward to target user(%s)",
-					currentUser.GetClientID(),
+			logger.Debugf(
+				"[user: %s][forward][connection: %s] start to forward to target user(%s)",
+				currentUser.GetClientID(),
+				forwardPacket.ConnectionID,
+				targetUser.GetClientID(),
+			)
+			// if err := targetUser.WritePacket(packet); err != nil {
+			// 	log.Error(
+			// 		"[user: %s][forward][connection: %s] failed to write packet: %v",
+			// 		userClientID,
+			// 		forwardPacket.ConnectionID,
+			// 		err,
+			// 	)
+			// 	return
+			// }
+
+			forwardPacket.Crypto = packet.Crypto
+			forwardPacket.Secret = targetUser.ClientSecret
+			if targetUser.ByToken() {
+				forwardPacket.Crypto = 0
+			}
+			forwardBytes, err := forwardPacket.Encode()
+			if err != nil {
+				log.Error(
+					"[user: %s][forward][connection: %s] failed to encode forward request packet: %v",
+					userClientID,
 					forwardPacket.ConnectionID,
-					targetUser.GetClientID(),
+					err,
 				)
-			case socksz.CommandClose:
-				closePacket := &close.Close{}
-				err := closePacket.Decode(packet.Data)
-				if err != nil {
-					ctx.Logger.Error(
-						"[user: %s][close][connection: %s] failed to decode close request packet: %v",
-						userClientID,
-						closePacket.ConnectionID,
-						err,
-					)
-					return
-				}
+				return
+			}
 
-				ctx.Logger.Info(
-					"[user: %s][close][connection: %s] coming ...",
+			packet.Data = forwardBytes
+			packet.Crypto = forwardPacket.Crypto
+			cipher, err := packet.Encode()
+			if err != nil {
+				log.Error(
+					"[user: %s][forward][connection: %s] failed to encode request packet: %v",
 					userClientID,
-					closePacket.ConnectionID,
+					forwardPacket.ConnectionID,
+					err,
 				)
+				return
+			}
 
-				logger.Debugf(
-					"[user: %s][close][connection: %s] start to check user pair ...",
+			if err := targetUser.WriteBytesTo(forwardPacket.ConnectionID, cipher); err != nil {
+				log.Error(
+					"[user: %s][forward][connection: %s] failed to write packet: %v",
 					userClientID,
-					closePacket.ConnectionID,
+					forwardPacket.ConnectionID,
+					err,
 				)
-				userPair, err := s.UserPairsByConnectionID.Get(closePacket.ConnectionID)
-				if err != nil {
-					ctx.Logger.Error(
-						"[user: %s][close][connection: %s] failed to get target user: %v",
-						userClientID,
-						closePacket.ConnectionID,
-						err,
-					)
 
-					// close self connection
-					if err := client.WriteBinary(raw); err != nil {
-						ctx.Logger.Error(
-							"[user: %s][close][connection: %s] failed to write close self connection: %v",
-							userClientID,
-							closePacket.ConnectionID,
-							err,
-						)
-					}
-					return
-				}
+				// close self connection
+				closeSelfConnection(forwardPacket.ConnectionID)
+				return
+			}
 
-				ctx.Logger.Info(
-					"[user: %s][close][connection: %s] pair(source: %s, target: %s) ...",
+			logger.Debugf(
+				"[user: %s][forward][connection: %s] succeed to forward to target user(%s)",
+				currentUser.GetClientID(),
+				forwardPacket.ConnectionID,
+				targetUser.GetClientID(),
+			)
+		case socksz.CommandClose:
+			closePacket := &close.Close{}
+			err := closePacket.Decode(packet.Data)
+			if err != nil {
+				log.Error(
+					"[user: %s][close][connection: %s] failed to decode close request packet: %v",
 					userClientID,
 					closePacket.ConnectionID,
-					userPair.Source.ClientID,
-					userPair.Target.ClientID,
+					err,
 				)
+				return
+			}
 
-				var targetUser *user.User
-				if currentUser.GetClientID() == userPair.Source.GetClientID() {
-					targetUser = userPair.Target
-				} else {
-					targetUser = userPair.Source
-				}
-
-				logger.Debugf(
-					"[user: %s][close][connection: %s] start to close to target user(%s)",
-					currentUser.GetClientID(),
+			log.Info(
+				"[user: %s][close][connection: %s] coming ...",
+				userClientID,
+				closePacket.ConnectionID,
+			)
+
+			logger.Debugf(
+				"[user: %s][close][connection: %s] start to check user pair ...",
+				userClientID,
+				closePacket.ConnectionID,
+			)
+			userPair, err := s.UserPairsByConnectionID.Get(closePacket.ConnectionID)
+			if err != nil {
+				log.Error(
+					"[user: %s][close][connection: %s] failed to get target user: %v",
+					userClientID,
 					closePacket.ConnectionID,
-					targetUser.GetClientID(),
+					err,
 				)
-				// if err := targetUser.WritePacket(packet); err != nil {
-				// 	ctx.Logger.Error(
-				// 		"[user: %s][close][connection: %s] failed to write packet: %v",
-				// 		userClientID,
-				// 		closePacket.ConnectionID,
-				// 		err,
-				// 	)
-				// 	return
-				// }
-				if err := targetUser.WriteBytes(raw); err != nil {
-					ctx.Logger.Error(
-						"[user: %s][close][connection: %s] failed to write packet: %v",
+
+				// close self connection
+				if err := client.WriteBinary(raw); err != nil {
+					log.Error(
+						"[user: %s][close][connection: %s] failed to write close self connection: %v",
 						userClientID,
 						closePacket.ConnectionID,
 						err,
 					)
-					return
 				}
+				return
+			}
+
+			log.Info(
+				"[user: %s][close][connection: %s] pair(source: %s, target: %s) ...",
+				userClientID,
+				closePacket.ConnectionID,
+				userPair.Source.ClientID,
+				userPair.Target.ClientID,
+			)
+
+			var targetUser *user.User
+			if currentUser.GetClientID() == userPair.Source.GetClientID() {
+				targetUser = userPair.Target
+			} else {
+				targetUser = userPair.Source
+			}
 
-				logger.Debugf(
-					"[user: %s][close][connection: %s] succeed to close to target user(%s)",
-					currentUser.GetClientID(),
+			logger.Debugf(
+				"[user: %s][close][connection: %s] start to close to target user(%s)",
+				currentUser.GetClientID(),
+				closePacket.ConnectionID,
+				targetUser.GetClientID(),
+			)
+			// if err := targetUser.WritePacket(packet); err != nil {
+			// 	log.Error(
+			// 		"[user: %s][close][connection: %s] failed to write packet: %v",
+			// 		userClientID,
+			// 		closePacket.ConnectionID,
+			// 		err,
+			// 	)
+			// 	return
+			// }
+			if err := targetUser.WriteBytesTo(closePacket.ConnectionID, raw); err != nil {
+				log.Error(
+					"[user: %s][close][connection: %s] failed to write packet: %v",
+					userClientID,
 					closePacket.ConnectionID,
-					targetUser.GetClientID(),
+					err,
 				)
+				return
+			}
 
-				// release connection
-				ctx.Logger.Info(
-					"[user: %s][close][connection: %s] release connection ...",
+			logger.Debugf(
+				"[user: %s][close][connection: %s] succeed to close to target user(%s)",
+				currentUser.GetClientID(),
+				closePacket.ConnectionID,
+				targetUser.GetClientID(),
+			)
+
+			// release connection
+			s.RemoteBinds.Remove(closePacket.ConnectionID)
+			currentUser.Release(closePacket.ConnectionID)
+			targetUser.Release(closePacket.ConnectionID)
+			log.Info(
+				"[user: %s][close][connection: %s] release connection ...",
+				userClientID,
+				closePacket.ConnectionID,
+			)
+			if err := s.UserPairsByConnectionID.Remove(closePacket.ConnectionID); err != nil {
+				log.Error(
+					"[user: %s][close][connection: %s] failed to release closed connection: %v",
 					userClientID,
 					closePacket.ConnectionID,
+					err,
 				)
-				if err := s.UserPairsByConnectionID.Remove(closePacket.ConnectionID); err != nil {
-					ctx.Logger.Error(
-						"[user: %s][close][connection: %s] failed to release closed connection: %v",
-						userClientID,
-						closePacket.ConnectionID,
-						err,
-					)
-				}
-			default:
-				logger.Warnf("[ignore] unknown command %d", packet.Cmd)
 			}
+		case protocol.CommandRemoteBindRequest:
+			s.handleRemoteBindRequest(currentUser, claims, client, packet)
+		case protocol.CommandRemoteBindResponse:
+			s.handleRemoteBindResponse(currentUser, packet)
+		case protocol.CommandPeerOffer:
+			s.handlePeerOffer(currentUser, claims, client, packet)
+		case protocol.CommandPeerAnswer:
+			s.handlePeerAnswer(currentUser, claims, client, packet)
+		case protocol.CommandSettings, protocol.CommandWindowUpdate, protocol.CommandCloseWrite:
+			s.relayConnectionPacket(currentUser, packet)
+		default:
+			logger.Warnf("[ignore] unknown command %d", packet.Cmd)
 		}
-	})
+	}
 
-	return core.Run(fmt.Sprintf(":%d", s.Port))
+	s.serveLink(log, client)
+}
+
+// serveLink reads messages of the link and handles them one by one,
+// unlike the websocket of zoox which handles each message in its own goroutine.
+func (s *server) serveLink(log *logger.Logger, client *websocket.Client) {
+	defer func() {
+		if client.OnDisconnect != nil {
+			client.OnDisconnect()
+		}
+	}()
+
+	if client.OnConnect != nil {
+		client.OnConnect()
+	}
+
+	for {
+		mt, message, err := client.ReadMessage()
+		if err != nil {
+			if e, ok := err.(*websocket.CloseError); ok && (e.Code == gowebsocket.CloseGoingAway || e.Code == gowebsocket.CloseAbnormalClosure) {
+				return
+			}
+
+			if client.OnError != nil {
+				client.OnError(err)
+			}
+			return
+		}
+
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					log.Errorf("[onmessage] panic: %v", err)
+				}
+			}()
+
+			switch mt {
+			case websocket.BinaryMessage:
+				if client.OnBinaryMessage != nil {
+					client.OnBinaryMessage(message)
+				}
+			case websocket.TextMessage:
+				if client.OnTextMessage != nil {
+					client.OnTextMessage(message)
+				}
+			default:
+				log.Warn("unknown message type: %d", mt)
+			}
+		}()
+	}
 }
 
 func (s *server) Bind(cfg *Bind) error {
@@ -676,7 +923,9 @@ func (s *server) Bind(cfg *Bind) error {
 					return fmt.Errorf("[bind] failed to get connection(%s): %v", forwardPacket.ConnectionID, err)
 				}
 
-				wsConn.Stream <- forwardPacket.Data
+				if err := wsConn.Receive(packet.Compression, forwardPacket.Data); err != nil {
+					return fmt.Errorf("[bind] connection(%s): %v", forwardPacket.ConnectionID, err)
+				}
 
 				// fmt.Println("write:", forwardPacket.Data)
 				// fmt.Println("fff:", len(bytes))
@@ -713,6 +962,8 @@ func (s *server) Bind(cfg *Bind) error {
 			wsConn.OnClose = func() {
 				connections.Remove(wsConn.ID)
 			}
+			// the target is not told of options
+			wsConn.SetHalfClose(false)
 			if err := connections.Set(wsConn.ID, wsConn); err != nil {
 				return nil, fmt.Errorf("[bind] failed to set connection(%s): %v", wsConn.ID, err)
 			}
@@ -732,10 +983,8 @@ func (s *server) Bind(cfg *Bind) error {
 				ConnectionID:       wsConn.ID,
 				TargetUserClientID: cfg.Target.UserClientID,
 				// TargetUserPairSignature: TargetUserPairSignature,
-				// @TODO
 				Network: uint8(Network),
-				// @TODO
-				ATyp:    handshake.ATypIPv4,
+				ATyp:    getATyp(cfg.RemoteHost),
 				DSTAddr: cfg.RemoteHost,
 				DSTPort: uint16(cfg.RemotePort),
 			}
@@ -758,6 +1007,39 @@ func (s *server) Bind(cfg *Bind) error {
 	return nil
 }
 
+// abortConnections closes the connections of user on links gone, and notifies the peers,
+// frames in flight on the links are lost, the connections cannot move to other links.
+func (s *server) abortConnections(currentUser *user.User, ids []string) {
+	for _, id := range ids {
+		pair, err := s.UserPairsByConnectionID.Get(id)
+		if err != nil {
+			continue
+		}
+
+		peer := pair.Target
+		if peer == currentUser {
+			peer = pair.Source
+		}
+
+		s.UserPairsByConnectionID.Remove(id)
+
+		data, err := (&close.Close{ConnectionID: id}).Encode()
+		if err != nil {
+			continue
+		}
+
+		logger.Infof("[user: %s][connection: %s] link is down, close connection with %s", currentUser.GetClientID(), id, peer.GetClientID())
+		if err := peer.WritePacketTo(id, &base.Base{
+			Ver:  socksz.VER,
+			Cmd:  socksz.CommandClose,
+			Data: data,
+		}); err != nil {
+			logger.Warnf("[user: %s][connection: %s] failed to notify %s: %v", currentUser.GetClientID(), id, peer.GetClientID(), err)
+		}
+		peer.Release(id)
+	}
+}
+
 func (s *server) GetSystemUser(write func(bytes []byte) error) (*user.User, error) {
 	userClientID := "id_system_"
 
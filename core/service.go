@@ -0,0 +1,121 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/go-zoox/gzfly/connection"
+	"github.com/go-zoox/logger"
+)
+
+// ServiceBacklog is the max number of connections waiting for Accept on a service listener.
+const ServiceBacklog = 128
+
+// ServiceAddr is the address of an in-process service.
+type ServiceAddr string
+
+// Network returns the name of the network.
+func (a ServiceAddr) Network() string {
+	return "gzfly"
+}
+
+func (a ServiceAddr) String() string {
+	return string(a)
+}
+
+type serviceListener struct {
+	name  string
+	conns chan net.Conn
+	//
+	closed  chan struct{}
+	once    sync.Once
+	onClose func()
+}
+
+// ListenService registers a virtual service name on this client, handshakes
+// whose destination host is the name are accepted by the returned listener,
+// instead of being dialed, whatever the destination port is.
+//
+// So a peer can reach an http.Server or grpc server served on the listener
+// with Dial(ctx, target, "tcp", "name:80") without opening a real local port.
+func (c *client) ListenService(name string) (net.Listener, error) {
+	if name == "" {
+		return nil, errors.New("service name is required")
+	}
+
+	c.serviceMu.Lock()
+	defer c.serviceMu.Unlock()
+
+	if _, err := c.services.Get(name); err == nil {
+		return nil, fmt.Errorf("service(%s) is already registered", name)
+	}
+
+	listener := &serviceListener{
+		name:   name,
+		conns:  make(chan net.Conn, ServiceBacklog),
+		closed: make(chan struct{}),
+	}
+	listener.onClose = func() {
+		c.serviceMu.Lock()
+		defer c.serviceMu.Unlock()
+
+		// the name may be registered again since
+		if current, err := c.services.Get(name); err == nil && current == listener {
+			c.services.Remove(name)
+		}
+	}
+	c.services.Set(name, listener)
+
+	logger.Info("[service] listen service: %s", name)
+	return listener, nil
+}
+
+// dispatch hands a connection over to Accept, it never blocks the caller.
+func (l *serviceListener) dispatch(conn *connection.WSConn) error {
+	select {
+	case <-l.closed:
+		return net.ErrClosed
+	default:
+	}
+
+	select {
+	case l.conns <- conn:
+		return nil
+	default:
+		return fmt.Errorf("service(%s) backlog is full", l.name)
+	}
+}
+
+func (l *serviceListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *serviceListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+		l.onClose()
+
+		// reject the connections never accepted
+		for {
+			select {
+			case conn := <-l.conns:
+				conn.Close()
+			default:
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+func (l *serviceListener) Addr() net.Addr {
+	return ServiceAddr(l.name)
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/go-zoox/gzfly/user"
+)
+
+func TestListenServiceOnce(t *testing.T) {
+	c, err := NewClient(&ClientConfig{User: user.New("id_peer_a", "secret_a", "pair_a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := c.(*client)
+
+	// concurrent registrations of one name, only one wins
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	registered := 0
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.ListenService("api"); err == nil {
+				mu.Lock()
+				registered++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if registered != 1 {
+		t.Fatalf("expect one registration, but got %d", registered)
+	}
+
+	first, err := cl.services.Get("api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+
+	second, err := c.ListenService("api")
+	if err != nil {
+		t.Fatalf("expect the name free once closed: %v", err)
+	}
+
+	// a late close of the former listener leaves the new one registered
+	first.onClose()
+	if current, err := cl.services.Get("api"); err != nil || current != second {
+		t.Fatal("expect the new listener to stay registered")
+	}
+}
@@ -0,0 +1,227 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/protocol/token"
+	"github.com/go-zoox/jwt"
+	"github.com/go-zoox/packet/socksz"
+	"github.com/go-zoox/packet/socksz/base"
+)
+
+// ServerToken enables authentication by tokens signed with Secret, instead of client secrets,
+// see IssueToken. Users of tokens must be in clients, client_secret may be empty for them.
+// Token sessions have no crypto, which is keyed by client secrets, use a tls transport instead.
+type ServerToken struct {
+	Secret string `config:"secret"`
+	// Audience is required to be the aud of tokens, if not empty
+	Audience string `config:"audience"`
+}
+
+// TokenClaims are the claims of a token of client.
+type TokenClaims struct {
+	// UserClientID is the sub of token
+	UserClientID string
+	Audience     string
+	// ExpiresAt is required, the session ends once the token expires
+	ExpiresAt time.Time
+	// Targets are the client ids the user may connect to, empty allows all
+	Targets []string
+}
+
+// ErrTokenExpired is returned by VerifyToken for expired tokens.
+var ErrTokenExpired = errors.New("token expired")
+
+// tokenPayload is the json payload of tokens.
+type tokenPayload struct {
+	Subject   string   `json:"sub"`
+	Audience  string   `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+	Targets   []string `json:"targets"`
+}
+
+// Allows returns true if the user may connect to target, nil claims allow all.
+func (c *TokenClaims) Allows(target string) bool {
+	if c == nil || len(c.Targets) == 0 {
+		return true
+	}
+
+	for _, t := range c.Targets {
+		if t == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Expiry returns when the session ends in unix seconds, 0 for nil claims,
+// sessions not by token never expire.
+func (c *TokenClaims) Expiry() int64 {
+	if c == nil {
+		return 0
+	}
+
+	return c.ExpiresAt.Unix()
+}
+
+// IssueToken signs the token of claims with secret, HS256.
+func IssueToken(secret string, claims *TokenClaims) (string, error) {
+	if secret == "" {
+		return "", errors.New("token secret is required")
+	}
+
+	if claims.UserClientID == "" {
+		return "", errors.New("user client id is required")
+	}
+
+	if claims.ExpiresAt.IsZero() {
+		return "", errors.New("expiry is required")
+	}
+
+	payload := map[string]any{}
+	if len(claims.Targets) != 0 {
+		payload["targets"] = claims.Targets
+	}
+
+	return jwt.Sign(secret, payload, &jwt.SignOptions{
+		Issuer:    "gzfly",
+		Subject:   claims.UserClientID,
+		Audience:  claims.Audience,
+		ExpiresAt: claims.ExpiresAt.Unix(),
+	})
+}
+
+// VerifyToken verifies the token signed with secret, and returns its claims.
+// audience is required to be the aud of token if not empty, exp is always required.
+// Nothing of the payload is trusted before the signature is verified, so ErrTokenExpired
+// only means a token of ours expired.
+func VerifyToken(secret, audience, token string) (*TokenClaims, error) {
+	if err := verifySignature(secret, token); err != nil {
+		return nil, err
+	}
+
+	payload, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload.ExpiresAt == 0 {
+		return nil, errors.New("token without expiry")
+	}
+
+	// tokens are expired from the second of exp, jwt.Verify accepts them in that second
+	if time.Now().Unix() >= payload.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+
+	if _, _, err := jwt.Verify(secret, token, &jwt.VerifyOptions{Audience: audience}); err != nil {
+		return nil, err
+	}
+
+	if payload.NotBefore != 0 && time.Now().Unix() < payload.NotBefore {
+		return nil, errors.New("token is not valid yet")
+	}
+
+	if payload.Subject == "" {
+		return nil, errors.New("token without subject")
+	}
+
+	return &TokenClaims{
+		UserClientID: payload.Subject,
+		Audience:     payload.Audience,
+		ExpiresAt:    time.Unix(payload.ExpiresAt, 0),
+		Targets:      payload.Targets,
+	}, nil
+}
+
+// ParseToken returns claims of token without verifying it, for clients to check their tokens.
+func ParseToken(token string) (*TokenClaims, error) {
+	payload, err := parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenClaims{
+		UserClientID: payload.Subject,
+		Audience:     payload.Audience,
+		ExpiresAt:    time.Unix(payload.ExpiresAt, 0),
+		Targets:      payload.Targets,
+	}, nil
+}
+
+// verifySignature verifies the HS256 signature of token, the algorithm of IssueToken.
+func verifySignature(secret, token string) error {
+	header, _, headerRaw, payloadRaw, signatureRaw, err := jwt.Parse(token)
+	if err != nil {
+		return fmt.Errorf("invalid token: %v", err)
+	}
+
+	if header.Algorithm != jwt.AlgHS256 {
+		return fmt.Errorf("unsupported token algorithm: %s", header.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(signatureRaw)
+	if err != nil {
+		return errors.New("invalid token signature")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(headerRaw + "." + payloadRaw))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("invalid token signature")
+	}
+
+	return nil
+}
+
+func parseToken(token string) (*tokenPayload, error) {
+	_, _, _, payloadRaw, _, err := jwt.Parse(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v", err)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payloadRaw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token payload: %v", err)
+	}
+
+	payload := &tokenPayload{}
+	if err := json.Unmarshal(data, payload); err != nil {
+		return nil, fmt.Errorf("invalid token payload: %v", err)
+	}
+
+	return payload, nil
+}
+
+// authenticateToken authenticates the link by token, the response is the same as by secret.
+func (c *client) authenticateToken(l *link) error {
+	data, err := (&token.Request{
+		UserClientID: c.User.GetClientID(),
+		Token:        c.token,
+	}).Encode()
+	if err != nil {
+		return err
+	}
+
+	packetBytes, err := (&base.Base{
+		Ver:  socksz.VER,
+		Cmd:  protocol.CommandAuthenticateToken,
+		Data: data,
+		//
+		Crypto: c.Crypto,
+	}).Encode()
+	if err != nil {
+		return fmt.Errorf("invalid message: %s", err)
+	}
+
+	return l.Write(MessageTypeBinary, packetBytes)
+}
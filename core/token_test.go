@@ -0,0 +1,95 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-zoox/gzfly/user"
+)
+
+func TestVerifyToken(t *testing.T) {
+	issue := func(secret string, claims *TokenClaims) string {
+		token, err := IssueToken(secret, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	valid := issue("secret", &TokenClaims{UserClientID: "id_04aba01", Audience: "relay", ExpiresAt: time.Now().Add(time.Hour), Targets: []string{"id_04aba02"}})
+	expired := issue("secret", &TokenClaims{UserClientID: "id_04aba01", ExpiresAt: time.Now().Add(-time.Hour)})
+	// signed by someone else, expired or not
+	forged := issue("other", &TokenClaims{UserClientID: "id_04aba01", ExpiresAt: time.Now().Add(time.Hour)})
+	forgedExpired := issue("other", &TokenClaims{UserClientID: "id_04aba01", ExpiresAt: time.Now().Add(-time.Hour)})
+
+	parts := strings.Split(expired, ".")
+	tampered := parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2]))
+
+	testCases := []struct {
+		name     string
+		token    string
+		audience string
+		err      string
+		expired  bool
+	}{
+		{name: "valid", token: valid, audience: "relay"},
+		{name: "without audience check", token: valid},
+		{name: "wrong audience", token: valid, audience: "other", err: "invalid audience"},
+		{name: "expired", token: expired, expired: true},
+		{name: "forged", token: forged, err: "invalid token signature"},
+		{name: "forged expired", token: forgedExpired, err: "invalid token signature"},
+		{name: "tampered expired", token: tampered, err: "invalid token signature"},
+		{name: "malformed", token: "not-a-token", err: "invalid token"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := VerifyToken("secret", tc.audience, tc.token)
+			if tc.expired {
+				if !errors.Is(err, ErrTokenExpired) {
+					t.Fatalf("expect expired, but got %v", err)
+				}
+				return
+			}
+
+			if tc.err != "" {
+				if err == nil || errors.Is(err, ErrTokenExpired) || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expect error %q, but got %v", tc.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.UserClientID != "id_04aba01" || !claims.Allows("id_04aba02") || claims.Allows("id_04aba03") {
+				t.Fatalf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestTokenSessionCrypto(t *testing.T) {
+	port := startRelay(t, &ServerConfig{Token: ServerToken{Secret: "token_secret"}})
+
+	token, err := IssueToken("token_secret", &TokenClaims{UserClientID: "id_peer_b", ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the client secret is not known to the token client
+	tokenUser := user.New("id_peer_b", "", testUsers["id_peer_b"].PairKey)
+	if _, err := NewClient(&ClientConfig{User: tokenUser, Token: token, Crypto: "aes-256-gcm"}); err == nil {
+		t.Fatal("expect crypto rejected with token")
+	}
+
+	a := startClient(t, port, "id_peer_a", &ClientConfig{Crypto: "aes-256-gcm"})
+	b := startClient(t, port, "id_peer_b", &ClientConfig{User: tokenUser, Token: token})
+	echo := startEcho(t)
+
+	// the relay does not encrypt for the token session, in both directions
+	dialEcho(t, a, testTarget("id_peer_b"), echo)
+	dialEcho(t, b, testTarget("id_peer_a"), echo)
+}
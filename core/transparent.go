@@ -0,0 +1,151 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/go-zoox/gzfly/network/utils"
+	"github.com/go-zoox/gzfly/router"
+	"github.com/go-zoox/logger"
+)
+
+// Transparent proxy modes.
+const (
+	// TransparentModeRedirect accepts connections redirected by iptables REDIRECT,
+	// the original destination is recovered with SO_ORIGINAL_DST.
+	TransparentModeRedirect = "redirect"
+	// TransparentModeTProxy accepts connections diverted by iptables TPROXY,
+	// the original destination is the local address of the connection.
+	TransparentModeTProxy = "tproxy"
+)
+
+// Transparent is a transparent proxy (tcp, linux only), forwarding connections
+// redirected by iptables to their original destinations through the target.
+//
+// Traffic of gzfly itself must be excluded from the iptables rules,
+// for example with `-m owner --uid-owner`, or it loops.
+type Transparent struct {
+	IP   string
+	Port int
+	// Mode is redirect (default) or tproxy
+	Mode string
+	//
+	Target *Target
+	// Router decides per connection to dial directly, reject or use a target,
+	// the default target is used if no rule matches.
+	Router *router.Router
+	// Targets are the named targets used as rule actions
+	Targets map[string]*Target
+}
+
+func (c *client) TransparentServe(cfg *Transparent) error {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = TransparentModeRedirect
+	}
+
+	logger.Info(
+		"[transparent] start to transparent serve with target(%s): %s://%s:%d",
+		cfg.Target.GetUserClientID(),
+		mode,
+		cfg.IP,
+		cfg.Port,
+	)
+
+	var getDst func(conn net.Conn) (string, int, error)
+	listenConfig := &net.ListenConfig{}
+	switch mode {
+	case TransparentModeRedirect:
+		getDst = getOriginalDst
+	case TransparentModeTProxy:
+		getDst = func(conn net.Conn) (string, int, error) {
+			return splitHostPort(conn.LocalAddr().String())
+		}
+		listenConfig.Control = setTransparent
+	default:
+		return fmt.Errorf("unknown transparent mode: %s, only support redirect/tproxy", mode)
+	}
+
+	listener, err := listenConfig.Listen(context.Background(), "tcp", net.JoinHostPort(cfg.IP, fmt.Sprintf("%d", cfg.Port)))
+	if err != nil {
+		return fmt.Errorf("failed to listen transparent server: %v", err)
+	}
+	defer listener.Close()
+
+	listenPort := listener.Addr().(*net.TCPAddr).Port
+
+	for {
+		source, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			continue
+		}
+
+		go func() {
+			host, port, err := getDst(source)
+			if err != nil {
+				logger.Warnf("[transparent] failed to get original destination of %s: %v", source.RemoteAddr(), err)
+				source.Close()
+				return
+			}
+
+			// connections to the listener itself are not redirected
+			if isListenerDst(host, port, listenPort, source.LocalAddr()) {
+				logger.Warnf("[transparent] %s connects to the listener directly, ignored", source.RemoteAddr())
+				source.Close()
+				return
+			}
+
+			logger.Infof("[transparent] request %s => %s", source.RemoteAddr(), net.JoinHostPort(host, fmt.Sprintf("%d", port)))
+
+			target, err := c.dialByRules("transparent", cfg.Router, cfg.Targets, cfg.Target, source.RemoteAddr().String(), host, port)
+			if err != nil {
+				logger.Warnf("[transparent] failed to connect: %v", err)
+				source.Close()
+				return
+			}
+
+			go utils.Relay(source, target)
+		}()
+	}
+}
+
+// isListenerDst reports whether host:port is the listener of port, accepting local,
+// which loops if forwarded. Connections not redirected get the listener as destination,
+// it may be any local address if the listener is on all addresses.
+func isListenerDst(host string, port int, listenPort int, local net.Addr) bool {
+	if port != listenPort {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+
+	if addr, ok := local.(*net.TCPAddr); ok && addr.IP.Equal(ip) {
+		return true
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// soOriginalDst is SO_ORIGINAL_DST in linux/netfilter_ipv4.h,
+	// and IP6T_SO_ORIGINAL_DST in linux/netfilter_ipv6/ip6_tables.h.
+	soOriginalDst = 80
+	// ipv6Transparent is IPV6_TRANSPARENT in linux/in6.h.
+	ipv6Transparent = 75
+)
+
+// getOriginalDst returns the destination before iptables REDIRECT.
+func getOriginalDst(conn net.Conn) (string, int, error) {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return "", 0, fmt.Errorf("only tcp connection is supported")
+	}
+
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return "", 0, err
+	}
+
+	isIPv4 := true
+	if addr, ok := conn.LocalAddr().(*net.TCPAddr); ok && addr.IP.To4() == nil {
+		isIPv4 = false
+	}
+
+	var ip net.IP
+	var port int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if isIPv4 {
+			// struct sockaddr_in fits in the 16 bytes of ipv6_mreq
+			mreq, err := syscall.GetsockoptIPv6Mreq(int(fd), syscall.SOL_IP, soOriginalDst)
+			if err != nil {
+				sockErr = err
+				return
+			}
+
+			port = int(mreq.Multiaddr[2])<<8 | int(mreq.Multiaddr[3])
+			ip = net.IPv4(mreq.Multiaddr[4], mreq.Multiaddr[5], mreq.Multiaddr[6], mreq.Multiaddr[7])
+			return
+		}
+
+		// struct sockaddr_in6 is the head of ip6_mtuinfo
+		info, err := syscall.GetsockoptIPv6MTUInfo(int(fd), syscall.SOL_IPV6, soOriginalDst)
+		if err != nil {
+			sockErr = err
+			return
+		}
+
+		p := (*[2]byte)(unsafe.Pointer(&info.Addr.Port))
+		port = int(p[0])<<8 | int(p[1])
+		ip = make(net.IP, net.IPv6len)
+		copy(ip, info.Addr.Addr[:])
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	if sockErr != nil {
+		return "", 0, fmt.Errorf("failed to get SO_ORIGINAL_DST: %v", sockErr)
+	}
+
+	return ip.String(), port, nil
+}
+
+// setTransparent sets IP_TRANSPARENT on listener, required by iptables TPROXY,
+// which needs CAP_NET_ADMIN.
+func setTransparent(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_IP, syscall.IP_TRANSPARENT, 1); sockErr != nil {
+			return
+		}
+
+		if network == "tcp6" {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_IPV6, ipv6Transparent, 1)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return fmt.Errorf("failed to set IP_TRANSPARENT: %v", sockErr)
+	}
+
+	return nil
+}
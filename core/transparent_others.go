@@ -0,0 +1,18 @@
+//go:build !linux
+
+package core
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"syscall"
+)
+
+func getOriginalDst(conn net.Conn) (string, int, error) {
+	return "", 0, fmt.Errorf("transparent proxy is not supported on %s", runtime.GOOS)
+}
+
+func setTransparent(network, address string, c syscall.RawConn) error {
+	return fmt.Errorf("transparent proxy is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsListenerDst(t *testing.T) {
+	local := &net.TCPAddr{IP: net.ParseIP("10.255.0.7"), Port: 17891}
+
+	cases := []struct {
+		host string
+		port int
+		self bool
+	}{
+		{"10.255.0.7", 17891, true},
+		{"::ffff:10.255.0.7", 17891, true},
+		{"127.0.0.1", 17891, true},
+		{"::1", 17891, true},
+		{"0.0.0.0", 17891, true},
+		{"10.255.0.7", 80, false},
+		{"93.184.216.34", 17891, false},
+		{"example.com", 17891, false},
+	}
+
+	for _, c := range cases {
+		if got := isListenerDst(c.host, c.port, 17891, local); got != c.self {
+			t.Errorf("isListenerDst(%s, %d) = %v, want %v", c.host, c.port, got, c.self)
+		}
+	}
+
+	// any address of local interfaces, when listening on all addresses
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		t.Skip(err)
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			if !isListenerDst(ipNet.IP.String(), 17891, 17891, &net.TCPAddr{IP: net.IPv4zero, Port: 17891}) {
+				t.Errorf("isListenerDst(%s) of local interface = false", ipNet.IP)
+			}
+		}
+	}
+}
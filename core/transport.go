@@ -0,0 +1,219 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/transport"
+	"github.com/go-zoox/logger"
+	"github.com/go-zoox/packet/socksz"
+	"github.com/go-zoox/zoox/components/application/websocket"
+)
+
+// ServerTLS is the certificate of the relay for tls, h2 and quic transports.
+type ServerTLS struct {
+	Cert string `config:"cert"`
+	Key  string `config:"key"`
+	// CA is the PEM file of certificates to verify client certificates with, empty disables them.
+	// A client certificate identifies the user of its subject (see user.MatchCertificate),
+	// the client secret is not checked unless RequireSecret.
+	CA            string `config:"ca"`
+	RequireSecret bool   `config:"require_secret"`
+}
+
+// streamOf returns the connection of frame as its stream, see transport.StreamFunc,
+// frames without connection, such as authenticate and remote bind, are on the control stream.
+func streamOf(frame []byte) (string, bool) {
+	// frame is an encoded base packet: VER|CMD|CRYPTO|COMPRESS|CONNID|...
+	const offset = 4
+	if len(frame) < offset+protocol.LengthConnectionID {
+		return "", false
+	}
+
+	id := string(frame[offset : offset+protocol.LengthConnectionID])
+	switch frame[1] {
+	case socksz.CommandClose:
+		return id, true
+	case socksz.CommandHandshakeResponse:
+		// CONNID|STATUS|..., no more frames once rejected
+		status := offset + protocol.LengthConnectionID
+		return id, len(frame) > status && frame[status] != socksz.StatusOK
+	case socksz.CommandHandshakeRequest,
+		socksz.CommandForward,
+		protocol.CommandSettings,
+		protocol.CommandWindowUpdate,
+		protocol.CommandCloseWrite:
+		return id, false
+	default:
+		return "", false
+	}
+}
+
+// relayTLS returns the tls config to verify the relay with certificates of ca file,
+// and to present the client certificate of cert and key files, nil if none of them.
+func relayTLS(ca, cert, key string) (*tls.Config, error) {
+	if ca == "" && cert == "" && key == "" {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{}
+	if ca != "" {
+		pool, err := loadCertPool(ca)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load relay ca: %v", err)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, fmt.Errorf("both relay cert and key are required")
+		}
+
+		certificate, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load relay cert: %v", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{certificate}
+	}
+
+	return cfg, nil
+}
+
+// loadCertPool returns the pool of certificates in the PEM file.
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("invalid %s: no certificate found", file)
+	}
+
+	return pool, nil
+}
+
+// listenTransports listens each of transports, such as tls://:6443, and serves accepted links.
+func (s *server) listenTransports() error {
+	if len(s.Transports) == 0 {
+		return nil
+	}
+
+	if s.TLS.Cert == "" || s.TLS.Key == "" {
+		return fmt.Errorf("tls cert and key are required by transports")
+	}
+
+	cert, err := tls.LoadX509KeyPair(s.TLS.Cert, s.TLS.Key)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %v", err)
+	}
+
+	cfg := &transport.ListenConfig{
+		TLS:    &tls.Config{Certificates: []tls.Certificate{cert}},
+		Stream: streamOf,
+	}
+
+	if s.TLS.CA != "" {
+		pool, err := loadCertPool(s.TLS.CA)
+		if err != nil {
+			return fmt.Errorf("failed to load client ca: %v", err)
+		}
+
+		// clients without certificates still authenticate by secret
+		cfg.TLS.ClientCAs = pool
+		cfg.TLS.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	for _, t := range s.Transports {
+		u, err := url.Parse(t)
+		if err != nil {
+			return fmt.Errorf("invalid transport(%s): %v", t, err)
+		}
+
+		listener, err := transport.Listen(u, cfg)
+		if err != nil {
+			return err
+		}
+
+		logger.Infof("[transport] listen %s at %s", u.Scheme, listener.Addr())
+		go s.serveTransport(listener)
+	}
+
+	return nil
+}
+
+// serveTransport serves links accepted by listener as websocket ones, until it is closed.
+func (s *server) serveTransport(listener transport.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			logger.Errorf("[transport] failed to accept at %s: %v", listener.Addr(), err)
+			return
+		}
+
+		go func() {
+			request, err := transport.ReadRequest(conn)
+			if err != nil {
+				logger.Errorf("[transport] failed to read request of %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+				return
+			}
+
+			if request.Path != s.Path {
+				logger.Errorf("[transport] %s requests unknown path: %s", conn.RemoteAddr(), request.Path)
+				conn.Close()
+				return
+			}
+
+			s.handleLink(logger.New(), websocket.New(&linkConn{conn: conn}), request.Query().Get("session"), transport.PeerCertificate(conn))
+		}()
+	}
+}
+
+// linkConn adapts links of transports to the websocket of zoox,
+// only methods used by websocket.Client are implemented.
+type linkConn struct {
+	websocket.Conn
+	conn transport.Conn
+}
+
+func (c *linkConn) ReadMessage() (int, []byte, error) {
+	return c.conn.ReadMessage()
+}
+
+func (c *linkConn) WriteMessage(messageType int, data []byte) error {
+	return c.conn.WriteMessage(messageType, data)
+}
+
+func (c *linkConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return c.conn.WriteMessage(messageType, data)
+}
+
+func (c *linkConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *linkConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *linkConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// pings and closes are handled by transports
+func (c *linkConn) SetPingHandler(h func(appData string) error) {}
+
+func (c *linkConn) SetPongHandler(h func(appData string) error) {}
+
+func (c *linkConn) SetCloseHandler(h func(code int, text string) error) {}
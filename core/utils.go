@@ -0,0 +1,102 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/go-zoox/gzfly/network"
+	"github.com/go-zoox/packet/socksz/handshake"
+)
+
+// getATyp returns the handshake address type of host,
+// hostnames are sent as domain and resolved by the target, so are IPv6 hosts
+// with a zone (fe80::1%eth0), which cannot be encoded as IPv6.
+func getATyp(host string) uint8 {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return handshake.ATypDomain
+	}
+
+	if ip.To4() != nil {
+		return handshake.ATypIPv4
+	}
+
+	return handshake.ATypIPv6
+}
+
+// getATypName returns the readable name of address type, used in logs.
+func getATypName(atyp uint8) string {
+	switch atyp {
+	case handshake.ATypIPv4:
+		return "ipv4"
+	case handshake.ATypIPv6:
+		return "ipv6"
+	case handshake.ATypDomain:
+		return "domain"
+	default:
+		return fmt.Sprintf("unknown(%d)", atyp)
+	}
+}
+
+// getNetwork returns the handshake network type of name, see network.Register.
+func getNetwork(name string) (uint8, error) {
+	n, err := network.Get(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown network type: %s", name)
+	}
+
+	return n.ID, nil
+}
+
+// getNetworkName returns the name of handshake network type.
+func getNetworkName(id uint8) (string, error) {
+	name, _, err := network.GetByID(id)
+	if err != nil {
+		return "", fmt.Errorf("unknown network type: 0x%02x", id)
+	}
+
+	return name, nil
+}
+
+// isSocketPath reports whether host is a unix socket path rather than a host,
+// paths always contain a slash, such as /var/run/docker.sock or ./app.sock.
+func isSocketPath(host string) bool {
+	return strings.Contains(host, "/")
+}
+
+// getEndpointNetwork returns the network of one endpoint of a bind,
+// unix binds may mix socket paths with host:port endpoints, which are tcp.
+func getEndpointNetwork(network, host string) string {
+	if network == "unix" && !isSocketPath(host) {
+		return "tcp"
+	}
+
+	return network
+}
+
+// formatAddress returns host:port, or the path of unix sockets, used in logs.
+func formatAddress(host string, port int) string {
+	if isSocketPath(host) {
+		return host
+	}
+
+	return net.JoinHostPort(host, fmt.Sprintf("%d", port))
+}
+
+// splitHostPort splits host:port into host and port,
+// IPv6 hosts must be in brackets, such as [::1]:80.
+func splitHostPort(hostport string) (string, int, error) {
+	host, portS, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", 0, err
+	}
+
+	port, err := strconv.Atoi(portS)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port: %s", portS)
+	}
+
+	return host, port, nil
+}
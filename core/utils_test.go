@@ -0,0 +1,106 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/go-zoox/packet/socksz/handshake"
+)
+
+func TestGetATyp(t *testing.T) {
+	cases := []struct {
+		host string
+		atyp uint8
+	}{
+		{"127.0.0.1", handshake.ATypIPv4},
+		{"0.0.0.0", handshake.ATypIPv4},
+		{"::ffff:10.0.0.1", handshake.ATypIPv4},
+		{"::1", handshake.ATypIPv6},
+		{"fd00::2", handshake.ATypIPv6},
+		{"2001:db8::1", handshake.ATypIPv6},
+		// zones cannot be encoded as ipv6, they are sent as domain and kept for the target
+		{"fe80::1%eth0", handshake.ATypDomain},
+		{"example.com", handshake.ATypDomain},
+		{"localhost", handshake.ATypDomain},
+		{"xn--fiqs8s.cn", handshake.ATypDomain},
+		{"", handshake.ATypDomain},
+	}
+
+	for _, c := range cases {
+		if got := getATyp(c.host); got != c.atyp {
+			t.Errorf("getATyp(%q) = %s, want %s", c.host, getATypName(got), getATypName(c.atyp))
+		}
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	cases := []struct {
+		hostport string
+		host     string
+		port     int
+		err      bool
+	}{
+		{hostport: "127.0.0.1:80", host: "127.0.0.1", port: 80},
+		{hostport: "[::1]:8080", host: "::1", port: 8080},
+		{hostport: "[fd00::2]:22", host: "fd00::2", port: 22},
+		{hostport: "[fe80::1%eth0]:443", host: "fe80::1%eth0", port: 443},
+		{hostport: "example.com:65535", host: "example.com", port: 65535},
+		{hostport: "localhost:0", host: "localhost", port: 0},
+		{hostport: ":53", host: "", port: 53},
+		{hostport: "example.com", err: true},
+		{hostport: "::1:80", err: true},
+		{hostport: "[::1]", err: true},
+		{hostport: "[::1:80", err: true},
+		{hostport: "example.com:http", err: true},
+		{hostport: "example.com:-1", err: true},
+		{hostport: "example.com:65536", err: true},
+		{hostport: "", err: true},
+	}
+
+	for _, c := range cases {
+		host, port, err := splitHostPort(c.hostport)
+		if c.err {
+			if err == nil {
+				t.Errorf("splitHostPort(%q) = %q, %d, want error", c.hostport, host, port)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("splitHostPort(%q): %v", c.hostport, err)
+			continue
+		}
+
+		if host != c.host || port != c.port {
+			t.Errorf("splitHostPort(%q) = %q, %d, want %q, %d", c.hostport, host, port, c.host, c.port)
+		}
+	}
+}
+
+func TestFormatAddress(t *testing.T) {
+	cases := []struct {
+		host    string
+		port    int
+		address string
+	}{
+		{"127.0.0.1", 80, "127.0.0.1:80"},
+		{"::1", 80, "[::1]:80"},
+		{"fe80::1%eth0", 80, "[fe80::1%eth0]:80"},
+		{"example.com", 443, "example.com:443"},
+		{"/var/run/docker.sock", 0, "/var/run/docker.sock"},
+	}
+
+	for _, c := range cases {
+		if got := formatAddress(c.host, c.port); got != c.address {
+			t.Errorf("formatAddress(%q, %d) = %q, want %q", c.host, c.port, got, c.address)
+		}
+
+		if isSocketPath(c.host) {
+			continue
+		}
+
+		host, port, err := splitHostPort(c.address)
+		if err != nil || host != c.host || port != c.port {
+			t.Errorf("splitHostPort(formatAddress(%q, %d)) = %q, %d, %v", c.host, c.port, host, port, err)
+		}
+	}
+}
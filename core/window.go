@@ -0,0 +1,123 @@
+package core
+
+import (
+	"fmt"
+
+	"github.com/go-zoox/gzfly/compression"
+	"github.com/go-zoox/gzfly/connection"
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/protocol/option"
+	"github.com/go-zoox/gzfly/protocol/settings"
+	"github.com/go-zoox/gzfly/protocol/window"
+	"github.com/go-zoox/gzfly/user"
+	"github.com/go-zoox/logger"
+	"github.com/go-zoox/packet/socksz/base"
+)
+
+// handshakeOptions returns the options appended to our handshake requests,
+// and sent back in settings.
+func (c *client) handshakeOptions() *option.Options {
+	return &option.Options{
+		Window:      connection.DefaultWindow,
+		Compression: c.compressions,
+		HalfClose:   true,
+		Datagram:    true,
+	}
+}
+
+// writeSettings tells the source the connection is accepted with our options,
+// only sent when the source has options in its handshake request.
+func (c *client) writeSettings(conn *connection.WSConn, status uint8, message string) error {
+	data, err := (&settings.Settings{
+		ConnectionID: conn.ID,
+		Status:       status,
+		Message:      message,
+		Options:      c.handshakeOptions(),
+	}).Encode()
+	if err != nil {
+		return err
+	}
+
+	return c.writePacketTo(conn.ID, protocol.CommandSettings, data)
+}
+
+func (c *client) handleSettings(packet *settings.Settings) {
+	logger.Debugf(
+		"[settings][connection: %s] settings (status: %d, window: %d, compression: %v)",
+		packet.ConnectionID,
+		packet.Status,
+		packet.Options.Window,
+		packet.Options.Compression,
+	)
+
+	conn, err := c.connections.Get(packet.ConnectionID)
+	if err != nil {
+		logger.Warnf("[settings][connection: %s] failed to get connection", packet.ConnectionID)
+		return
+	}
+
+	conn.SetDatagram(packet.Status == STATUS_OK && packet.Options.Datagram)
+	conn.SetHalfClose(packet.Status == STATUS_OK && packet.Options.HalfClose)
+	if packet.Status != STATUS_OK {
+		logger.Errorf("[settings][connection: %s] target failed to accept connection (status: %d): %s", packet.ConnectionID, packet.Status, packet.Message)
+		conn.Abort(fmt.Errorf("target failed to accept connection (status: %d): %s", packet.Status, packet.Message))
+		c.linkConns.Remove(conn.ID)
+		return
+	}
+
+	conn.SetCompression(compression.Select(c.compressions, packet.Options.Compression))
+
+	if packet.Options.Window == 0 {
+		return
+	}
+
+	// settings come the same way as window updates, so the target supports them
+	if err := conn.OpenWindow(packet.Options.Window, true); err != nil {
+		logger.Warnf("[settings][connection: %s] failed to open window: %v", packet.ConnectionID, err)
+	}
+}
+
+func (c *client) handleWindowUpdate(packet *window.Update) {
+	conn, err := c.connections.Get(packet.ConnectionID)
+	if err != nil {
+		// data may be still in flight after close
+		logger.Debugf("[window][connection: %s] failed to get connection", packet.ConnectionID)
+		return
+	}
+
+	if packet.Limited {
+		conn.PeerLimited(packet.Sent)
+	}
+	conn.UpdateWindow(packet.Increment)
+}
+
+// relayConnectionPacket passes settings, window updates and half-closes to the peer
+// of the connection, all of them start with CONNECTION_ID.
+func (s *server) relayConnectionPacket(currentUser *user.User, packet *base.Base) {
+	if len(packet.Data) < protocol.LengthConnectionID {
+		logger.Error("[user: %s][connection] invalid packet(cmd: %d), too short", currentUser.GetClientID(), packet.Cmd)
+		return
+	}
+	connectionID := string(packet.Data[:protocol.LengthConnectionID])
+
+	userPair, err := s.UserPairsByConnectionID.Get(connectionID)
+	if err != nil {
+		logger.Debugf("[user: %s][connection: %s] failed to get user pair (cmd: %d)", currentUser.GetClientID(), connectionID, packet.Cmd)
+		return
+	}
+
+	var targetUser *user.User
+	switch currentUser.GetClientID() {
+	case userPair.Source.GetClientID():
+		targetUser = userPair.Target
+	case userPair.Target.GetClientID():
+		targetUser = userPair.Source
+	default:
+		logger.Error("[user: %s][connection: %s] not a peer of the connection (cmd: %d)", currentUser.GetClientID(), connectionID, packet.Cmd)
+		return
+	}
+
+	if err := targetUser.WritePacketTo(connectionID, packet); err != nil {
+		logger.Error("[user: %s][connection: %s] failed to write packet(cmd: %d) to %s: %v", currentUser.GetClientID(), connectionID, packet.Cmd, targetUser.GetClientID(), err)
+	}
+}
@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the max entries kept in cache.
+const DefaultCacheSize = 1024
+
+// Cache caches dns responses by question until the min ttl of answers expires.
+type Cache struct {
+	sync.Mutex
+	Size int
+	//
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	response  []byte
+	expiresAt time.Time
+}
+
+// NewCache creates a cache holding at most size entries.
+func NewCache(size int) *Cache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	return &Cache{
+		Size:    size,
+		entries: map[string]*cacheEntry{},
+	}
+}
+
+// Get returns a copy of the cached response of key, with ttl untouched.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	response := make([]byte, len(entry.response))
+	copy(response, entry.response)
+	return response, true
+}
+
+// Set caches the response of key for ttl.
+func (c *Cache) Set(key string, response []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= c.Size {
+		// drop expired entries first, then any if still full
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+
+		for k := range c.entries {
+			if len(c.entries) < c.Size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+
+	data := make([]byte, len(response))
+	copy(data, response)
+	c.entries[key] = &cacheEntry{
+		response:  data,
+		expiresAt: now.Add(ttl),
+	}
+}
@@ -0,0 +1,148 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// MaxMessageSize is the max size of dns message over tcp.
+const MaxMessageSize = 65535
+
+// Question parses the header and the first question of message.
+func Question(message []byte) (dnsmessage.Header, dnsmessage.Question, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(message)
+	if err != nil {
+		return header, dnsmessage.Question{}, err
+	}
+
+	question, err := parser.Question()
+	if err != nil {
+		return header, question, err
+	}
+
+	return header, question, nil
+}
+
+// Key returns the cache key of question.
+func Key(question dnsmessage.Question) string {
+	return fmt.Sprintf("%s/%s/%s", strings.ToLower(question.Name.String()), question.Type, question.Class)
+}
+
+// Domain returns the domain of question without the trailing dot.
+func Domain(question dnsmessage.Question) string {
+	return strings.TrimSuffix(question.Name.String(), ".")
+}
+
+// TTL returns the min ttl of answers in response, used as cache ttl,
+// only successful responses with answers and NXDOMAIN are cached.
+func TTL(response []byte) time.Duration {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(response)
+	if err != nil {
+		return 0
+	}
+
+	if header.Truncated {
+		return 0
+	}
+
+	if err := parser.SkipAllQuestions(); err != nil {
+		return 0
+	}
+
+	answers, err := parser.AllAnswers()
+	if err != nil {
+		return 0
+	}
+
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+		if len(answers) == 0 {
+			return 0
+		}
+	case dnsmessage.RCodeNameError:
+		// negative cache, ttl from SOA in authorities, or a short default
+		authorities, err := parser.AllAuthorities()
+		if err != nil || len(authorities) == 0 {
+			return 30 * time.Second
+		}
+		answers = authorities
+	default:
+		return 0
+	}
+
+	ttl := answers[0].Header.TTL
+	for _, answer := range answers[1:] {
+		if answer.Header.TTL < ttl {
+			ttl = answer.Header.TTL
+		}
+	}
+
+	return time.Duration(ttl) * time.Second
+}
+
+// SetID rewrites the id of message in place, used by cached responses.
+func SetID(message []byte, id uint16) {
+	if len(message) < 2 {
+		return
+	}
+
+	binary.BigEndian.PutUint16(message[:2], id)
+}
+
+// Reply builds an empty response of query with rcode, such as SERVFAIL or REFUSED.
+func Reply(query []byte, rcode dnsmessage.RCode) ([]byte, error) {
+	header, question, err := Question(query)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Response = true
+	header.RecursionAvailable = true
+	header.RCode = rcode
+
+	builder := dnsmessage.NewBuilder(nil, header)
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := builder.Question(question); err != nil {
+		return nil, err
+	}
+
+	return builder.Finish()
+}
+
+// ReadTCP reads a length prefixed dns message, as RFC 1035 4.2.2.
+func ReadTCP(reader io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+
+	message := make([]byte, length)
+	if _, err := io.ReadFull(reader, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// WriteTCP writes a length prefixed dns message, as RFC 1035 4.2.2.
+func WriteTCP(writer io.Writer, message []byte) error {
+	if len(message) > MaxMessageSize {
+		return fmt.Errorf("dns message too large: %d", len(message))
+	}
+
+	data := make([]byte, 2+len(message))
+	binary.BigEndian.PutUint16(data[:2], uint16(len(message)))
+	copy(data[2:], message)
+
+	_, err := writer.Write(data)
+	return err
+}
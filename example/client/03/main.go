@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	tow "github.com/go-zoox/gzfly/core"
+	"github.com/go-zoox/gzfly/user"
+	"github.com/go-zoox/logger"
+)
+
+func main() {
+	client, _ := tow.NewClient(&tow.ClientConfig{
+		Protocol: "ws",
+		Host:     "127.0.0.1",
+		Port:     1080,
+		Path:     "/",
+		// USER
+		User: user.New("id_04aba02", "29f4e3d3a4302b4d9e02", "pair_3fd02"),
+	})
+
+	client.OnConnect(func() {
+		dialer := tow.NewDialer(client, &tow.Target{
+			UserClientID: "id_04aba01",
+			UserPairKey:  "pair_3fd01",
+		})
+
+		// requests go through peer id_04aba01, without a local listener
+		httpClient := &http.Client{
+			Transport: &http.Transport{
+				DialContext: dialer.DialContext,
+			},
+		}
+
+		response, err := httpClient.Get("http://127.0.0.1:8080")
+		if err != nil {
+			logger.Error("failed to request: %v", err)
+			return
+		}
+		defer response.Body.Close()
+
+		body, _ := io.ReadAll(response.Body)
+		logger.Info("response: %s", body)
+	})
+
+	if err := client.Listen(); err != nil {
+		fmt.Println("listen error:", err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	tow "github.com/go-zoox/gzfly/core"
+	"github.com/go-zoox/gzfly/user"
+	"github.com/go-zoox/logger"
+)
+
+func main() {
+	client, _ := tow.NewClient(&tow.ClientConfig{
+		Protocol: "ws",
+		Host:     "127.0.0.1",
+		Port:     1080,
+		Path:     "/",
+		// USER
+		User: user.New("id_04aba01", "29f4e3d3a4302b4d9e01", "pair_3fd01"),
+	})
+
+	// peers reach it with Dial(ctx, target, "tcp", "hello:80"), no local port is opened
+	listener, err := client.ListenService("hello")
+	if err != nil {
+		logger.Fatal("failed to listen service: %v", err)
+		return
+	}
+
+	go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello from gzfly service"))
+	}))
+
+	if err := client.Listen(); err != nil {
+		fmt.Println("listen error:", err)
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/go-zoox/cli v1.3.3
 	github.com/go-zoox/core-utils v1.2.13
 	github.com/go-zoox/crypto v1.1.8
+	github.com/go-zoox/jwt v1.3.0
 	github.com/go-zoox/logger v1.4.4
 	github.com/go-zoox/packet v1.3.0
 	github.com/go-zoox/random v1.0.4
@@ -13,6 +14,9 @@ require (
 	github.com/go-zoox/socks5 v0.0.3
 	github.com/go-zoox/zoox v1.10.14
 	github.com/gorilla/websocket v1.5.0
+	github.com/klauspost/compress v1.17.9
+	github.com/quic-go/quic-go v0.40.1
+	golang.org/x/net v0.12.0
 )
 
 require (
@@ -22,6 +26,7 @@ require (
 	github.com/fatih/color v1.15.0 // indirect
 	github.com/fsnotify/fsnotify v1.6.0 // indirect
 	github.com/go-redis/redis/v8 v8.11.5 // indirect
+	github.com/go-task/slim-sprig v0.0.0-20230315185526-52ccab3ef572 // indirect
 	github.com/go-zoox/cache v1.0.3 // indirect
 	github.com/go-zoox/chalk v1.0.2 // indirect
 	github.com/go-zoox/compress v1.0.1 // indirect
@@ -40,7 +45,6 @@ require (
 	github.com/go-zoox/headers v1.0.8 // indirect
 	github.com/go-zoox/ini v1.0.4 // indirect
 	github.com/go-zoox/jobqueue v1.0.0 // indirect
-	github.com/go-zoox/jwt v1.3.0 // indirect
 	github.com/go-zoox/kv v1.5.1 // indirect
 	github.com/go-zoox/proxy v1.4.1 // indirect
 	github.com/go-zoox/ratelimit v1.2.0 // indirect
@@ -49,14 +53,17 @@ require (
 	github.com/go-zoox/tag v1.2.2 // indirect
 	github.com/go-zoox/uuid v0.0.1 // indirect
 	github.com/goccy/go-yaml v1.11.0 // indirect
+	github.com/google/pprof v0.0.0-20210407192527-94a9f03dee38 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/joho/godotenv v1.5.1 // indirect
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0 // indirect
 	github.com/matoous/go-nanoid/v2 v2.0.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
+	github.com/onsi/ginkgo/v2 v2.9.5 // indirect
 	github.com/pelletier/go-toml v1.9.5 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
+	github.com/quic-go/qtls-go1-20 v0.4.1 // indirect
 	github.com/robfig/cron/v3 v3.0.1 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/sevlyar/go-daemon v0.1.6 // indirect
@@ -66,10 +73,13 @@ require (
 	github.com/tidwall/pretty v1.2.1 // indirect
 	github.com/urfave/cli/v2 v2.25.7 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
+	go.uber.org/mock v0.3.0 // indirect
 	golang.org/x/crypto v0.11.0 // indirect
-	golang.org/x/net v0.12.0 // indirect
+	golang.org/x/exp v0.0.0-20221205204356-47842c84f3db // indirect
+	golang.org/x/mod v0.11.0 // indirect
 	golang.org/x/sys v0.10.0 // indirect
 	golang.org/x/text v0.11.0 // indirect
+	golang.org/x/tools v0.9.1 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -14,6 +14,7 @@ func main() {
 
 	command.RegisterClient(app)
 	command.RegisterServer(app)
+	command.RegisterToken(app)
 
 	app.Run()
 }
@@ -71,3 +71,7 @@ func (m *Manager[T]) GetOrCreate(id string, creator func() (T, error)) (T, error
 	m.cache.Set(id, instance)
 	return instance, nil
 }
+
+func (m *Manager[T]) Keys() []string {
+	return m.cache.Keys()
+}
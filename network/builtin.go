@@ -0,0 +1,74 @@
+package network
+
+import (
+	"net"
+
+	"github.com/go-zoox/gzfly/network/tcp"
+	"github.com/go-zoox/gzfly/network/udp"
+	"github.com/go-zoox/gzfly/network/unix"
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/packet/socksz/handshake"
+)
+
+// builtin networks, registered before any custom one.
+func init() {
+	Register("tcp", &Network{
+		ID: handshake.NetworkTCP,
+		Serve: func(cfg *ServeConfig) error {
+			return tcp.Serve(&tcp.ServeConfig{
+				Host:     cfg.Host,
+				Port:     cfg.Port,
+				OnConn:   cfg.OnConn,
+				OnListen: cfg.OnListen,
+			})
+		},
+		Connect: func(source net.Conn, cfg *ConnectTarget) error {
+			return tcp.Connect(source, &tcp.ConnectTarget{
+				Host:    cfg.Host,
+				Port:    cfg.Port,
+				Options: cfg.Options,
+				ID:      cfg.ID,
+			})
+		},
+	})
+
+	Register("udp", &Network{
+		ID: handshake.NetworkUDP,
+		Serve: func(cfg *ServeConfig) error {
+			return udp.Serve(&udp.ServeConfig{
+				Host:     cfg.Host,
+				Port:     cfg.Port,
+				OnConn:   cfg.OnConn,
+				OnListen: cfg.OnListen,
+			})
+		},
+		Connect: func(source net.Conn, cfg *ConnectTarget) error {
+			return udp.Connect(source, &udp.ConnectTarget{
+				Host:    cfg.Host,
+				Port:    cfg.Port,
+				Options: cfg.Options,
+				ID:      cfg.ID,
+			})
+		},
+	})
+
+	Register("unix", &Network{
+		ID: protocol.NetworkUnix,
+		Serve: func(cfg *ServeConfig) error {
+			return unix.Serve(&unix.ServeConfig{
+				Path:     cfg.Host,
+				Mode:     cfg.Mode,
+				Owner:    cfg.Owner,
+				OnConn:   cfg.OnConn,
+				OnListen: cfg.OnListen,
+			})
+		},
+		Connect: func(source net.Conn, cfg *ConnectTarget) error {
+			return unix.Connect(source, &unix.ConnectTarget{
+				Path:    cfg.Host,
+				Options: cfg.Options,
+				ID:      cfg.ID,
+			})
+		},
+	})
+}
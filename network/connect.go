@@ -4,33 +4,33 @@ import (
 	"fmt"
 	"net"
 
-	"github.com/go-zoox/gzfly/network/tcp"
-	"github.com/go-zoox/gzfly/network/udp"
+	"github.com/go-zoox/gzfly/network/utils"
 )
 
+// DialOptions controls how targets are dialed, see utils.DialOptions.
+type DialOptions = utils.DialOptions
+
 type ConnectTarget struct {
 	Type string
+	// Host is the socket path for unix
 	Host string
 	Port int
+	// Options controls dialing, nil uses the defaults
+	Options *DialOptions
 	//
 	ID string
 }
 
+// Connect connects with the network registered as cfg.Type.
 func Connect(source net.Conn, cfg *ConnectTarget) error {
-	switch cfg.Type {
-	case "tcp":
-		return tcp.Connect(source, &tcp.ConnectTarget{
-			Host: cfg.Host,
-			Port: cfg.Port,
-			ID:   cfg.ID,
-		})
-	case "udp":
-		return udp.Connect(source, &udp.ConnectTarget{
-			Host: cfg.Host,
-			Port: cfg.Port,
-			ID:   cfg.ID,
-		})
-	default:
-		return fmt.Errorf("network type(%s) not supported", cfg.Type)
+	network, err := Get(cfg.Type)
+	if err != nil {
+		return err
+	}
+
+	if network.Connect == nil {
+		return fmt.Errorf("network type(%s) does not support connect", cfg.Type)
 	}
+
+	return network.Connect(source, cfg)
 }
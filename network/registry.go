@@ -0,0 +1,68 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/go-zoox/gzfly/manager"
+)
+
+// ServeFunc listens as cfg and relays each accepted connection with the one from cfg.OnConn.
+type ServeFunc func(cfg *ServeConfig) error
+
+// ConnectFunc connects to the target of cfg and relays it with source.
+type ConnectFunc func(source net.Conn, cfg *ConnectTarget) error
+
+// Network is one type of network, registered by name, such as tcp.
+type Network struct {
+	// ID is the NETWORK byte of handshake, custom networks should use 0x80 - 0xFF
+	ID uint8
+	// Serve listens for binds, nil if the network cannot listen
+	Serve ServeFunc
+	// Connect connects to targets of handshake, nil if the network cannot connect
+	Connect ConnectFunc
+}
+
+var (
+	networks   = manager.New[*Network]()
+	registerMu sync.Mutex
+)
+
+// Register registers the network by name, both ends of a connection must register it
+// with the same id, networks cannot be replaced once registered.
+func Register(name string, network *Network) error {
+	registerMu.Lock()
+	defer registerMu.Unlock()
+
+	if _, err := networks.Get(name); err == nil {
+		return fmt.Errorf("network type(%s) already registered", name)
+	}
+
+	if other, _, err := GetByID(network.ID); err == nil {
+		return fmt.Errorf("network id(0x%02x) already registered by %s", network.ID, other)
+	}
+
+	return networks.Set(name, network)
+}
+
+// Get returns the network registered by name.
+func Get(name string) (*Network, error) {
+	network, err := networks.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("network type(%s) not supported", name)
+	}
+
+	return network, nil
+}
+
+// GetByID returns the name and network registered with the handshake id.
+func GetByID(id uint8) (string, *Network, error) {
+	for _, name := range networks.Keys() {
+		if network, err := networks.Get(name); err == nil && network.ID == id {
+			return name, network, nil
+		}
+	}
+
+	return "", nil, fmt.Errorf("network id(0x%02x) not supported", id)
+}
@@ -2,34 +2,34 @@ package network
 
 import (
 	"fmt"
+	"io"
 	"net"
-
-	"github.com/go-zoox/gzfly/network/tcp"
-	"github.com/go-zoox/gzfly/network/udp"
+	"os"
 )
 
 type ServeConfig struct {
-	Type   string
-	Host   string
-	Port   int
+	Type string
+	// Host is the socket path for unix
+	Host string
+	Port int
+	// Mode and Owner are the permission of the socket file for unix, see unix.ServeConfig
+	Mode   os.FileMode
+	Owner  string
 	OnConn func() (net.Conn, error)
+	// OnListen is called once listening, close the listener to stop serving
+	OnListen func(listener io.Closer)
 }
 
+// Serve serves with the network registered as cfg.Type.
 func Serve(cfg *ServeConfig) error {
-	switch cfg.Type {
-	case "tcp":
-		return tcp.Serve(&tcp.ServeConfig{
-			Host:   cfg.Host,
-			Port:   cfg.Port,
-			OnConn: cfg.OnConn,
-		})
-	case "udp":
-		return udp.Serve(&udp.ServeConfig{
-			Host:   cfg.Host,
-			Port:   cfg.Port,
-			OnConn: cfg.OnConn,
-		})
-	default:
-		return fmt.Errorf("network type(%s) not supported", cfg.Type)
+	network, err := Get(cfg.Type)
+	if err != nil {
+		return err
+	}
+
+	if network.Serve == nil {
+		return fmt.Errorf("network type(%s) does not support serve", cfg.Type)
 	}
+
+	return network.Serve(cfg)
 }
@@ -0,0 +1,70 @@
+package network
+
+import (
+	"errors"
+	"net"
+
+	"github.com/go-zoox/gzfly/network/utils"
+	"github.com/go-zoox/logger"
+)
+
+// Stream creates a stream network from listen and dial, such as an in-memory pipe
+// or a custom TLS dialer, connections are relayed with half-close like tcp.
+// Either listen or dial can be nil if the network only serves or connects,
+// accept errors other than net.ErrClosed stop serving.
+func Stream(id uint8, listen func(cfg *ServeConfig) (net.Listener, error), dial func(cfg *ConnectTarget) (net.Conn, error)) *Network {
+	network := &Network{
+		ID: id,
+	}
+
+	if listen != nil {
+		network.Serve = func(cfg *ServeConfig) error {
+			listener, err := listen(cfg)
+			if err != nil {
+				return err
+			}
+			defer listener.Close()
+
+			if cfg.OnListen != nil {
+				cfg.OnListen(listener)
+			}
+
+			for {
+				source, err := listener.Accept()
+				if err != nil {
+					if errors.Is(err, net.ErrClosed) {
+						return nil
+					}
+
+					return err
+				}
+
+				go func() {
+					target, err := cfg.OnConn()
+					if err != nil {
+						logger.Warn("[%s] failed to connect to server: %v", cfg.Type, err)
+						source.Close()
+						return
+					}
+
+					utils.Relay(source, target)
+				}()
+			}
+		}
+	}
+
+	if dial != nil {
+		network.Connect = func(source net.Conn, cfg *ConnectTarget) error {
+			conn, err := dial(cfg)
+			if err != nil {
+				return err
+			}
+
+			go utils.Relay(source, conn)
+
+			return nil
+		}
+	}
+
+	return network
+}
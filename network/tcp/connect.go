@@ -12,6 +12,8 @@ import (
 type ConnectTarget struct {
 	Host string
 	Port int
+	// Options controls dialing, nil uses the defaults
+	Options *utils.DialOptions
 	//
 	ID string
 }
@@ -20,13 +22,12 @@ func Connect(source net.Conn, cfg *ConnectTarget) error {
 	addr := net.JoinHostPort(cfg.Host, fmt.Sprintf("%d", cfg.Port))
 	logger.Infof("[connection:tcp][%s] connect to: %s", cfg.ID, addr)
 
-	conn, err := net.Dial("tcp", addr)
+	conn, err := cfg.Options.Dial("tcp", addr)
 	if err != nil {
 		return err
 	}
 
-	go utils.Copy(source, conn)
-	go utils.Copy(conn, source)
+	go utils.Relay(source, conn)
 
 	return nil
 }
@@ -1,8 +1,11 @@
 package tcp
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 
 	"github.com/go-zoox/gzfly/network/utils"
 	"github.com/go-zoox/logger"
@@ -12,19 +15,31 @@ type ServeConfig struct {
 	Host   string
 	Port   int
 	OnConn func() (net.Conn, error)
+	// OnListen is called once listening, close the listener to stop serving
+	OnListen func(listener io.Closer)
 }
 
 func Serve(cfg *ServeConfig) error {
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	// empty host or :: listens on both IPv4 and IPv6
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
 	logger.Info("listen tcp server at: %s", addr)
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to listen tcp server: %v", err)
 	}
 	defer listener.Close()
+
+	if cfg.OnListen != nil {
+		cfg.OnListen(listener)
+	}
+
 	for {
 		source, err := listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
 			continue
 		}
 
@@ -40,8 +55,7 @@ func Serve(cfg *ServeConfig) error {
 
 			logger.Info("[tcp] server connected")
 
-			go utils.Copy(source, target)
-			go utils.Copy(target, source)
+			go utils.Relay(source, target)
 		}()
 	}
 }
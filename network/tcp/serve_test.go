@@ -0,0 +1,97 @@
+package tcp
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServeLoopback(t *testing.T) {
+	testCases := []struct {
+		host string
+		dial string
+	}{
+		{"127.0.0.1", "127.0.0.1"},
+		{"::1", "::1"},
+		// empty host listens on both
+		{"", "127.0.0.1"},
+		{"", "::1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(net.JoinHostPort(tc.host, "0")+"<-"+tc.dial, func(t *testing.T) {
+			if net.ParseIP(tc.dial).To4() == nil && !hasIPv6() {
+				t.Skip("ipv6 is not available")
+			}
+
+			port := serve(t, tc.host)
+
+			conn, err := net.DialTimeout("tcp", net.JoinHostPort(tc.dial, port), time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+			if _, err := conn.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 5)
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Fatal(err)
+			}
+			if string(buf) != "hello" {
+				t.Fatalf("expect hello, but got %q", buf)
+			}
+		})
+	}
+}
+
+// serve serves on host at any port, echoing each connection, returns the port.
+func serve(t *testing.T, host string) string {
+	listening := make(chan net.Listener, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(&ServeConfig{
+			Host: host,
+			Port: 0,
+			OnConn: func() (net.Conn, error) {
+				conn, peer := net.Pipe()
+				go func() {
+					defer peer.Close()
+					io.Copy(peer, peer)
+				}()
+				return conn, nil
+			},
+			OnListen: func(listener io.Closer) {
+				listening <- listener.(net.Listener)
+			},
+		})
+	}()
+
+	select {
+	case listener := <-listening:
+		t.Cleanup(func() {
+			listener.Close()
+			if err := <-done; err != nil {
+				t.Errorf("serve: %v", err)
+			}
+		})
+
+		_, port, _ := net.SplitHostPort(listener.Addr().String())
+		return port
+	case err := <-done:
+		t.Fatalf("failed to serve: %v", err)
+		return ""
+	}
+}
+
+func hasIPv6() bool {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
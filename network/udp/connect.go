@@ -3,6 +3,7 @@ package udp
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/go-zoox/gzfly/network/utils"
 	"github.com/go-zoox/logger"
@@ -11,6 +12,8 @@ import (
 type ConnectTarget struct {
 	Host string
 	Port int
+	// Options controls dialing, nil uses the defaults
+	Options *utils.DialOptions
 	//
 	ID string
 }
@@ -19,13 +22,30 @@ func Connect(source net.Conn, cfg *ConnectTarget) error {
 	addr := net.JoinHostPort(cfg.Host, fmt.Sprintf("%d", cfg.Port))
 	logger.Infof("[connection:udp][%s] connect to: %s", cfg.ID, addr)
 
-	conn, err := net.Dial("udp", addr)
+	conn, err := cfg.Options.Dial("udp", addr)
 	if err != nil {
 		return err
 	}
 
-	go utils.Copy(source, conn)
-	go utils.Copy(conn, source)
+	// replies of the dialed socket belong to the session of source
+	go relay(NewDatagramConn(source), conn, DefaultIdleTimeout)
 
 	return nil
 }
+
+// relay copies datagrams between the tunnel and the dialed socket until idle.
+func relay(tunnel *DatagramConn, conn net.Conn, idleTimeout time.Duration) {
+	idle := newIdleTimer()
+	stop := func() {
+		tunnel.Close()
+		conn.Close()
+	}
+
+	go func() {
+		defer stop()
+		copyDatagrams(conn, tunnel, idle, idleTimeout)
+	}()
+
+	defer stop()
+	copyDatagrams(tunnel, conn, idle, idleTimeout)
+}
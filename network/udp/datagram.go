@@ -0,0 +1,127 @@
+package udp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Datagrams over the stream of a tunnel connection, boundaries are kept by length:
+//   LENGTH | DATA
+//     2    |  -
+//
+//   LENGTH - DATA 长度，2字节，网络字节序
+//
+// 仅在对端支持时使用（握手选项 DATAGRAM），否则每个数据报原样写入，
+// 边界依赖于每次写入一个数据帧。
+
+// MaxDatagramSize is the max size of a datagram.
+const MaxDatagramSize = 65535
+
+// Framer is a connection knowing whether peer frames datagrams.
+type Framer interface {
+	Datagram() bool
+}
+
+// DatagramConn reads and writes whole datagrams over a stream connection,
+// each Write sends one datagram and each Read returns one.
+// Datagrams are framed unless the connection is a Framer whose peer does not.
+type DatagramConn struct {
+	net.Conn
+
+	framedOnce sync.Once
+	framed     bool
+
+	readMu  sync.Mutex
+	writeMu sync.Mutex
+	// the datagram being read, kept across reads interrupted by deadlines
+	header  [2]byte
+	headerN int
+	payload []byte
+	readN   int
+}
+
+// NewDatagramConn creates a datagram connection over conn.
+func NewDatagramConn(conn net.Conn) *DatagramConn {
+	return &DatagramConn{
+		Conn: conn,
+	}
+}
+
+// isFramed decides on first use, as the options of peer may come after the connection.
+func (c *DatagramConn) isFramed() bool {
+	c.framedOnce.Do(func() {
+		c.framed = true
+		if framer, ok := c.Conn.(Framer); ok {
+			c.framed = framer.Datagram()
+		}
+	})
+
+	return c.framed
+}
+
+// Read reads one datagram, the rest of it is discarded if b is too small, like UDP.
+func (c *DatagramConn) Read(b []byte) (int, error) {
+	if !c.isFramed() {
+		return c.Conn.Read(b)
+	}
+
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for c.headerN < len(c.header) {
+		n, err := c.Conn.Read(c.header[c.headerN:])
+		c.headerN += n
+		if err != nil {
+			if err == io.EOF && c.headerN != 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+	}
+
+	if c.payload == nil {
+		c.payload = make([]byte, binary.BigEndian.Uint16(c.header[:]))
+	}
+
+	for c.readN < len(c.payload) {
+		n, err := c.Conn.Read(c.payload[c.readN:])
+		c.readN += n
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.payload)
+	c.headerN, c.payload, c.readN = 0, nil, 0
+	return n, nil
+}
+
+// Write sends b as one datagram.
+func (c *DatagramConn) Write(b []byte) (int, error) {
+	if len(b) > MaxDatagramSize {
+		return 0, fmt.Errorf("datagram too large: %d", len(b))
+	}
+
+	if !c.isFramed() {
+		return c.Conn.Write(b)
+	}
+
+	frame := make([]byte, 2+len(b))
+	binary.BigEndian.PutUint16(frame, uint16(len(b)))
+	copy(frame[2:], b)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
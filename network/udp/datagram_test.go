@@ -0,0 +1,94 @@
+package udp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+// framer is a stream connection whose peer frames datagrams or not.
+type framer struct {
+	net.Conn
+	datagram bool
+}
+
+func (f *framer) Datagram() bool {
+	return f.datagram
+}
+
+func TestDatagramConn(t *testing.T) {
+	testCases := []struct {
+		name string
+		wrap func(conn net.Conn) net.Conn
+		// raw is whether datagrams are written as is
+		raw bool
+	}{
+		{"stream", func(conn net.Conn) net.Conn { return conn }, false},
+		{"framed", func(conn net.Conn) net.Conn { return &framer{conn, true} }, false},
+		{"raw", func(conn net.Conn) net.Conn { return &framer{conn, false} }, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := net.Pipe()
+			defer a.Close()
+			defer b.Close()
+
+			conn := NewDatagramConn(tc.wrap(a))
+			datagram := []byte("hello")
+
+			go conn.Write(datagram)
+
+			wire := make([]byte, 64)
+			n, err := b.Read(wire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := append([]byte{0x00, byte(len(datagram))}, datagram...)
+			if tc.raw {
+				expected = datagram
+			}
+			if !bytes.Equal(wire[:n], expected) {
+				t.Fatalf("expect %x on the wire, but got %x", expected, wire[:n])
+			}
+
+			go b.Write(expected)
+
+			buf := make([]byte, MaxDatagramSize)
+			n, err = conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf[:n], datagram) {
+				t.Fatalf("expect %q, but got %q", datagram, buf[:n])
+			}
+		})
+	}
+}
+
+func TestDatagramConnBoundaries(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	writer := NewDatagramConn(a)
+	reader := NewDatagramConn(b)
+
+	datagrams := [][]byte{[]byte("a"), {}, bytes.Repeat([]byte("b"), 4096)}
+	go func() {
+		for _, datagram := range datagrams {
+			writer.Write(datagram)
+		}
+	}()
+
+	buf := make([]byte, MaxDatagramSize)
+	for _, datagram := range datagrams {
+		n, err := reader.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], datagram) {
+			t.Fatalf("expect %d bytes, but got %d", len(datagram), n)
+		}
+	}
+}
@@ -1,93 +1,148 @@
 package udp
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/go-zoox/logger"
-
-	"github.com/go-zoox/gzfly/network/utils"
 )
 
 type ServeConfig struct {
 	Host   string
 	Port   int
 	OnConn func() (net.Conn, error)
+	// OnListen is called once listening, close the listener to stop serving
+	OnListen func(listener io.Closer)
+	// IdleTimeout closes sessions without datagrams, default DefaultIdleTimeout
+	IdleTimeout time.Duration
 }
 
+// Serve serves datagrams from clients, each client address is a session
+// with its own tunnel connection from OnConn, closed once idle.
 func Serve(cfg *ServeConfig) error {
-	addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
+	// empty host or :: listens on both IPv4 and IPv6
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
 	logger.Info("listen udp server at: %s", addr)
-	s, err := net.ResolveUDPAddr("udp4", addr)
-	listener, err := net.ListenUDP("udp4", s)
+	s, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve udp server address: %v", err)
+	}
+	listener, err := net.ListenUDP("udp", s)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to listen udp server: %v", err)
 	}
 	defer listener.Close()
 
+	if cfg.OnListen != nil {
+		cfg.OnListen(listener)
+	}
+
+	idleTimeout := cfg.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+
+	sessions := &sessions{
+		items: map[string]*session{},
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go sessions.expire(idleTimeout, stop)
+
+	buffer := make([]byte, MaxDatagramSize)
 	for {
-		source, err := acceptUDP(listener) // listener.ReadFromUDP(buffer)
+		n, addr, err := listener.ReadFromUDP(buffer)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				sessions.closeAll()
+				return nil
+			}
+
 			continue
 		}
 
-		logger.Info("[udp] client connected")
+		session, created := sessions.getOrCreate(addr)
+		if created {
+			logger.Info("[udp][session: %s] client connected", addr)
 
-		go func() {
-			target, err := cfg.OnConn()
-			if err != nil {
-				logger.Warn("[udp] failed to connect to server: %v", err)
-				source.Close()
-				return
-			}
-
-			logger.Info("[udp] server connected")
+			go func() {
+				session.run(cfg.OnConn, listener)
+				sessions.remove(addr.String(), session)
+			}()
+		}
 
-			go utils.Copy(source, target)
-			go utils.Copy(target, source)
-		}()
+		session.push(append([]byte(nil), buffer[:n]...))
 	}
 }
 
-func acceptUDP(udp *net.UDPConn) (*UDPConn, error) {
-	buffer := make([]byte, 1024)
-	n, addr, err := udp.ReadFromUDP(buffer)
-	if err != nil {
-		return nil, err
-	}
-
-	return &UDPConn{
-		Origin:     udp,
-		OriginAddr: addr,
-		Buffer:     buffer[:n],
-	}, nil
+// sessions are keyed by client address.
+type sessions struct {
+	sync.Mutex
+	items map[string]*session
 }
 
-type UDPConn struct {
-	net.Conn
+func (ss *sessions) getOrCreate(addr *net.UDPAddr) (*session, bool) {
+	ss.Lock()
+	defer ss.Unlock()
 
-	Origin     *net.UDPConn
-	OriginAddr *net.UDPAddr
+	key := addr.String()
+	if s, ok := ss.items[key]; ok {
+		return s, false
+	}
 
-	Buffer []byte
+	s := newSession(addr)
+	ss.items[key] = s
+	return s, true
 }
 
-func (c *UDPConn) Read(b []byte) (n int, err error) {
-	return copy(b, c.Buffer), err
-}
+func (ss *sessions) remove(key string, s *session) {
+	ss.Lock()
+	defer ss.Unlock()
 
-func (c *UDPConn) Write(b []byte) (n int, err error) {
-	return c.Origin.WriteToUDP(b, c.OriginAddr)
+	if ss.items[key] == s {
+		delete(ss.items, key)
+	}
 }
 
-func (c *UDPConn) Close() error {
-	return nil
-}
+// expire closes sessions idle for timeout, until stop.
+func (ss *sessions) expire(timeout time.Duration, stop <-chan struct{}) {
+	interval := timeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
 
-func (c *UDPConn) LocalAddr() net.Addr {
-	return c.Origin.LocalAddr()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ss.Lock()
+			for key, s := range ss.items {
+				if s.idle.idle() >= timeout {
+					logger.Info("[udp][session: %s] closed, idle for %s", key, timeout)
+					delete(ss.items, key)
+					go s.close()
+				}
+			}
+			ss.Unlock()
+		case <-stop:
+			return
+		}
+	}
 }
 
-func (c *UDPConn) RemoteAddr() net.Addr {
-	return c.Origin.RemoteAddr()
+func (ss *sessions) closeAll() {
+	ss.Lock()
+	defer ss.Unlock()
+
+	for key, s := range ss.items {
+		delete(ss.items, key)
+		go s.close()
+	}
 }
@@ -0,0 +1,112 @@
+package udp
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestServeLoopback(t *testing.T) {
+	testCases := []struct {
+		host string
+		dial string
+	}{
+		{"127.0.0.1", "127.0.0.1"},
+		{"::1", "::1"},
+		// empty host listens on both
+		{"", "127.0.0.1"},
+		{"", "::1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(net.JoinHostPort(tc.host, "0")+"<-"+tc.dial, func(t *testing.T) {
+			if net.ParseIP(tc.dial).To4() == nil && !hasIPv6() {
+				t.Skip("ipv6 is not available")
+			}
+
+			port := serve(t, tc.host)
+
+			// replies must come from the dialed address, or the connected socket drops them
+			conn, err := net.Dial("udp", net.JoinHostPort(tc.dial, port))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+			buf := make([]byte, MaxDatagramSize)
+			for _, datagram := range []string{"hello", "world"} {
+				if _, err := conn.Write([]byte(datagram)); err != nil {
+					t.Fatal(err)
+				}
+				n, err := conn.Read(buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(buf[:n]) != datagram {
+					t.Fatalf("expect %q, but got %q", datagram, buf[:n])
+				}
+			}
+		})
+	}
+}
+
+// serve serves on host at any port, echoing datagrams of each session, returns the port.
+func serve(t *testing.T, host string) string {
+	listening := make(chan *net.UDPConn, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(&ServeConfig{
+			Host: host,
+			Port: 0,
+			OnConn: func() (net.Conn, error) {
+				conn, peer := net.Pipe()
+				go func() {
+					tunnel := NewDatagramConn(peer)
+					defer tunnel.Close()
+
+					buf := make([]byte, MaxDatagramSize)
+					for {
+						n, err := tunnel.Read(buf)
+						if err != nil {
+							return
+						}
+						if _, err := tunnel.Write(buf[:n]); err != nil {
+							return
+						}
+					}
+				}()
+				return conn, nil
+			},
+			OnListen: func(listener io.Closer) {
+				listening <- listener.(*net.UDPConn)
+			},
+		})
+	}()
+
+	select {
+	case listener := <-listening:
+		t.Cleanup(func() {
+			listener.Close()
+			if err := <-done; err != nil {
+				t.Errorf("serve: %v", err)
+			}
+		})
+
+		_, port, _ := net.SplitHostPort(listener.LocalAddr().String())
+		return port
+	case err := <-done:
+		t.Fatalf("failed to serve: %v", err)
+		return ""
+	}
+}
+
+func hasIPv6() bool {
+	conn, err := net.ListenPacket("udp", "[::1]:0")
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
@@ -0,0 +1,172 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-zoox/logger"
+)
+
+// DefaultIdleTimeout closes sessions without datagrams in either direction.
+const DefaultIdleTimeout = 60 * time.Second
+
+// sessionQueueSize is the datagrams queued while the session connects, more are dropped.
+const sessionQueueSize = 64
+
+// session is the datagrams from one client address, carried by one tunnel connection.
+type session struct {
+	sync.Mutex
+
+	addr  *net.UDPAddr
+	queue chan []byte
+	idle  *idleTimer
+	//
+	conn   net.Conn
+	done   chan struct{}
+	closed bool
+}
+
+func newSession(addr *net.UDPAddr) *session {
+	return &session{
+		addr:  addr,
+		queue: make(chan []byte, sessionQueueSize),
+		idle:  newIdleTimer(),
+		done:  make(chan struct{}),
+	}
+}
+
+// push queues the datagram from client, dropped if the queue is full like UDP.
+func (s *session) push(datagram []byte) {
+	s.idle.touch()
+
+	select {
+	case s.queue <- datagram:
+	default:
+		logger.Debugf("[udp][session: %s] drop datagram, queue is full", s.addr)
+	}
+}
+
+// run connects the tunnel, then relays datagrams until the session is closed.
+func (s *session) run(onConn func() (net.Conn, error), listener *net.UDPConn) {
+	defer s.close()
+
+	target, err := onConn()
+	if err != nil {
+		logger.Warn("[udp][session: %s] failed to connect to server: %v", s.addr, err)
+		return
+	}
+
+	tunnel := NewDatagramConn(target)
+	if !s.attach(tunnel) {
+		tunnel.Close()
+		return
+	}
+
+	logger.Info("[udp][session: %s] server connected", s.addr)
+
+	go func() {
+		for {
+			select {
+			case datagram := <-s.queue:
+				if _, err := tunnel.Write(datagram); err != nil {
+					s.close()
+					return
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}()
+
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		n, err := tunnel.Read(buf)
+		if err != nil {
+			return
+		}
+
+		s.idle.touch()
+		if _, err := listener.WriteToUDP(buf[:n], s.addr); err != nil {
+			logger.Debugf("[udp][session: %s] failed to write: %v", s.addr, err)
+		}
+	}
+}
+
+// attach sets the tunnel of session, false if the session is closed already.
+func (s *session) attach(conn net.Conn) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.conn = conn
+	return true
+}
+
+func (s *session) close() {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.done)
+
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// idleTimer tracks the last activity of datagrams in both directions.
+type idleTimer struct {
+	last atomic.Int64
+}
+
+func newIdleTimer() *idleTimer {
+	t := &idleTimer{}
+	t.touch()
+	return t
+}
+
+func (t *idleTimer) touch() {
+	t.last.Store(time.Now().UnixNano())
+}
+
+func (t *idleTimer) idle() time.Duration {
+	return time.Since(time.Unix(0, t.last.Load()))
+}
+
+// copyDatagrams copies datagrams from src to dst until idle for timeout,
+// read deadlines of src are used to check idle, so src stops once it is idle.
+func copyDatagrams(dst, src net.Conn, idle *idleTimer, timeout time.Duration) error {
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		src.SetReadDeadline(time.Now().Add(timeout))
+
+		n, err := src.Read(buf)
+		if err != nil {
+			// the other direction may be active
+			if errors.Is(err, os.ErrDeadlineExceeded) && idle.idle() < timeout {
+				continue
+			}
+			return err
+		}
+
+		idle.touch()
+		if _, err := dst.Write(buf[:n]); err != nil {
+			var opErr *net.OpError
+			// such as ICMP port unreachable, the next datagram may be fine
+			if errors.As(err, &opErr) && opErr.Op == "write" && opErr.Net == "udp" {
+				continue
+			}
+			return err
+		}
+	}
+}
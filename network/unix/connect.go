@@ -0,0 +1,30 @@
+package unix
+
+import (
+	"net"
+
+	"github.com/go-zoox/logger"
+
+	"github.com/go-zoox/gzfly/network/utils"
+)
+
+type ConnectTarget struct {
+	Path string
+	// Options controls dialing, only the timeout applies to unix
+	Options *utils.DialOptions
+	//
+	ID string
+}
+
+func Connect(source net.Conn, cfg *ConnectTarget) error {
+	logger.Infof("[connection:unix][%s] connect to: %s", cfg.ID, cfg.Path)
+
+	conn, err := cfg.Options.Dial("unix", cfg.Path)
+	if err != nil {
+		return err
+	}
+
+	go utils.Relay(source, conn)
+
+	return nil
+}
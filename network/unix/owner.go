@@ -0,0 +1,61 @@
+package unix
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// setPermission changes the mode and owner of the socket file,
+// zero mode or empty owner is left unchanged.
+func setPermission(path string, mode os.FileMode, owner string) error {
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+
+	if owner == "" {
+		return nil
+	}
+
+	uid, gid, err := lookupOwner(owner)
+	if err != nil {
+		return err
+	}
+
+	return os.Chown(path, uid, gid)
+}
+
+// lookupOwner returns the uid and gid of user[:group],
+// gid is -1 if group is omitted, which keeps the group unchanged.
+func lookupOwner(owner string) (uid int, gid int, err error) {
+	userName, groupName, _ := strings.Cut(owner, ":")
+
+	uid, gid = -1, -1
+	if userName != "" {
+		if uid, err = strconv.Atoi(userName); err != nil {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid owner user(%s): %v", userName, err)
+			}
+
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+
+	if groupName != "" {
+		if gid, err = strconv.Atoi(groupName); err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid owner group(%s): %v", groupName, err)
+			}
+
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+
+	return uid, gid, nil
+}
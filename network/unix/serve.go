@@ -0,0 +1,96 @@
+package unix
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/go-zoox/gzfly/network/utils"
+	"github.com/go-zoox/logger"
+)
+
+type ServeConfig struct {
+	Path string
+	// Mode is the permission of the socket file, such as 0660, zero keeps the default of umask
+	Mode os.FileMode
+	// Owner is the owner of the socket file, format: user[:group] in names or ids, empty keeps the current user
+	Owner  string
+	OnConn func() (net.Conn, error)
+	// OnListen is called once listening, close the listener to stop serving
+	OnListen func(listener io.Closer)
+}
+
+// Serve serves the unix socket at path, the socket file is removed once closed.
+func Serve(cfg *ServeConfig) error {
+	logger.Info("listen unix server at: %s", cfg.Path)
+	if err := removeStale(cfg.Path); err != nil {
+		return fmt.Errorf("failed to listen unix server: %v", err)
+	}
+
+	listener, err := net.Listen("unix", cfg.Path)
+	if err != nil {
+		return fmt.Errorf("failed to listen unix server: %v", err)
+	}
+	defer listener.Close()
+
+	if err := setPermission(cfg.Path, cfg.Mode, cfg.Owner); err != nil {
+		return fmt.Errorf("failed to set permission of unix socket %s: %v", cfg.Path, err)
+	}
+
+	if cfg.OnListen != nil {
+		cfg.OnListen(listener)
+	}
+
+	for {
+		source, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+
+			continue
+		}
+
+		logger.Info("[unix] client connected")
+
+		go func() {
+			target, err := cfg.OnConn()
+			if err != nil {
+				logger.Warn("[unix] failed to connect to server: %v", err)
+				source.Close()
+				return
+			}
+
+			logger.Info("[unix] server connected")
+
+			go utils.Relay(source, target)
+		}()
+	}
+}
+
+// removeStale removes the socket file left by a dead process,
+// sockets still accepting connections are kept.
+func removeStale(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s already exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+
+	return os.Remove(path)
+}
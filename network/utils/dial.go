@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-zoox/gzfly/network/upstream"
+)
+
+// DefaultDialTimeout is the timeout of dialing targets.
+const DefaultDialTimeout = 10 * time.Second
+
+// DialOptions controls how targets are dialed.
+type DialOptions struct {
+	// Timeout of dial, default DefaultDialTimeout
+	Timeout time.Duration
+	// KeepAlive is the period of TCP keepalive probes, zero uses the default (15s), negative disables it
+	KeepAlive time.Duration
+	// Nagle enables Nagle's algorithm, TCP_NODELAY is set by default
+	Nagle bool
+	// SourceIP is the local ip to dial tcp and udp from, only targets of its family are dialed
+	SourceIP string
+	// Interface is the network interface to dial tcp and udp from, linux only
+	Interface string
+	// FallbackDelay is how long to wait before racing the other family of dual-stack
+	// names (Happy Eyeballs), zero uses the default (300ms), negative disables it
+	FallbackDelay time.Duration
+	// Proxy is the upstream proxy to dial tcp through, nil dials directly
+	Proxy *upstream.Proxy
+}
+
+// Dial dials address on network with the options, nil options use the defaults.
+func (o *DialOptions) Dial(network, address string) (net.Conn, error) {
+	if o == nil {
+		o = &DialOptions{}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:       o.Timeout,
+		KeepAlive:     o.KeepAlive,
+		FallbackDelay: o.FallbackDelay,
+	}
+	if dialer.Timeout == 0 {
+		dialer.Timeout = DefaultDialTimeout
+	}
+
+	// unix sockets have no source address
+	isIP := strings.HasPrefix(network, "tcp") || strings.HasPrefix(network, "udp")
+	if isIP && o.SourceIP != "" {
+		ip := net.ParseIP(o.SourceIP)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source ip: %s", o.SourceIP)
+		}
+
+		if strings.HasPrefix(network, "tcp") {
+			dialer.LocalAddr = &net.TCPAddr{IP: ip}
+		} else {
+			dialer.LocalAddr = &net.UDPAddr{IP: ip}
+		}
+	}
+	if isIP && o.Interface != "" {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			return bindToDevice(c, o.Interface)
+		}
+	}
+
+	dial := func(network, address string) (net.Conn, error) {
+		conn, err := dialer.Dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		if tcpConn, ok := conn.(*net.TCPConn); ok && o.Nagle {
+			tcpConn.SetNoDelay(false)
+		}
+
+		return conn, nil
+	}
+
+	if o.Proxy != nil && strings.HasPrefix(network, "tcp") {
+		return o.Proxy.Dial(dial, "tcp", address, dialer.Timeout)
+	}
+
+	return dial(network, address)
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToDevice sets SO_BINDTODEVICE, which needs CAP_NET_RAW before linux 5.7.
+func bindToDevice(c syscall.RawConn, name string) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.BindToDevice(int(fd), name)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return fmt.Errorf("failed to bind to interface %s: %v", name, sockErr)
+	}
+
+	return nil
+}
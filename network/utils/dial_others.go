@@ -0,0 +1,13 @@
+//go:build !linux
+
+package utils
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+func bindToDevice(c syscall.RawConn, name string) error {
+	return fmt.Errorf("binding to interface is not supported on %s", runtime.GOOS)
+}
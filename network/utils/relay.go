@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// Relay copies data between a and b in both directions until both are done,
+// EOF in one direction shuts down writing of the other end only, so that
+// the response is still relayed back.
+func Relay(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		halfCopy(a, b)
+	}()
+	go func() {
+		defer wg.Done()
+		halfCopy(b, a)
+	}()
+
+	wg.Wait()
+	a.Close()
+	b.Close()
+}
+
+func halfCopy(dst, src net.Conn) {
+	if _, err := io.Copy(dst, src); err != nil {
+		// broken, stop the other direction too
+		dst.Close()
+		src.Close()
+		return
+	}
+
+	CloseWrite(dst)
+}
+
+// CloseWrite shuts down writing of conn if supported, such as TCP,
+// otherwise conn is closed.
+func CloseWrite(conn net.Conn) error {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		return c.CloseWrite()
+	}
+
+	return conn.Close()
+}
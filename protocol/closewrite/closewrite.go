@@ -0,0 +1,38 @@
+package closewrite
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-zoox/gzfly/protocol"
+)
+
+// CloseWrite represents the half-close of a connection
+type CloseWrite struct {
+	ConnectionID string
+}
+
+// Encode encodes the data
+func (r *CloseWrite) Encode() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	n, err := buf.WriteString(r.ConnectionID)
+	if n != protocol.LengthConnectionID || err != nil {
+		return nil, fmt.Errorf("failed to write ConnectionID: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the data
+func (r *CloseWrite) Decode(raw []byte) error {
+	reader := bytes.NewReader(raw)
+
+	buf, err := protocol.ReadFixed(reader, protocol.LengthConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to read connection id: %s", err)
+	}
+	r.ConnectionID = string(buf)
+
+	return nil
+}
@@ -0,0 +1,12 @@
+package closewrite
+
+// BASE:
+//  VER | CMD | CRYPTO | COMPRESS | DATA
+//   1  |  1  |  1     |   1      | -
+
+// Close Write DATA, sent once the sender shuts down writing, after its last data:
+//   CONNECTION_ID
+//       13
+//
+//   对端读完之前的数据后读到 EOF，反方向的数据继续传输，
+//   仅在对端握手选项含 HALF_CLOSE 时发送
@@ -0,0 +1,52 @@
+package protocol
+
+// Commands extending github.com/go-zoox/packet/socksz,
+// numbered after socksz.CommandJoinAsAgent.
+const (
+	// CommandRemoteBindRequest client <-server-> client
+	CommandRemoteBindRequest = 0x08
+	// CommandRemoteBindResponse client <-server-> client
+	CommandRemoteBindResponse = 0x09
+	// CommandSettings client <-server-> client, from target once connection accepted
+	CommandSettings = 0x0A
+	// CommandWindowUpdate client <-server-> client
+	CommandWindowUpdate = 0x0B
+	// CommandCloseWrite client <-server-> client
+	CommandCloseWrite = 0x0C
+	// CommandPeerOffer client <-server-> client
+	CommandPeerOffer = 0x0D
+	// CommandPeerAnswer client <-server-> client
+	CommandPeerAnswer = 0x0E
+	// CommandAuthenticateToken client -> server, answered by socksz.CommandAuthenticate
+	CommandAuthenticateToken = 0x0F
+)
+
+// Networks extending handshake.NetworkTCP and handshake.NetworkUDP,
+// the address of unix is the socket path with port 0.
+const (
+	// NetworkUnix is the unix domain socket (stream)
+	NetworkUnix = 0x03
+)
+
+const (
+	// LengthBindID is the byte length of BIND_ID, same as CONNECTION_ID
+	LengthBindID = 13
+	// LengthPort is the byte length of PORT
+	LengthPort = 2
+	// LengthStatus is the byte length of STATUS
+	LengthStatus = 1
+	// LengthSignature is the byte length of HMAC_SHA256 signature
+	LengthSignature = 64
+	// LengthConnectionID is the byte length of CONNECTION_ID
+	LengthConnectionID = 13
+	// LengthIncrement is the byte length of window INCREMENT
+	LengthIncrement = 4
+	// LengthSent is the byte length of window SENT
+	LengthSent = 8
+	// LengthPeerID is the byte length of PEER_ID, same as CONNECTION_ID
+	LengthPeerID = 13
+	// LengthFingerprint is the byte length of SHA256 certificate FINGERPRINT
+	LengthFingerprint = 32
+	// LengthExpires is the byte length of peer EXPIRES
+	LengthExpires = 8
+)
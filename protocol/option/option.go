@@ -0,0 +1,140 @@
+package option
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/go-zoox/packet/socksz"
+	"github.com/go-zoox/packet/socksz/handshake"
+)
+
+// Magic is the prefix of options.
+var Magic = []byte{0x47, 0x5A}
+
+// Option types.
+const (
+	TypeWindow      = 0x01
+	TypeCompression = 0x02
+	TypeHalfClose   = 0x03
+	TypeDatagram    = 0x04
+)
+
+// Options are the capabilities of one side of a connection.
+type Options struct {
+	// Window is the initial receive window in bytes, 0 means no flow control
+	Window uint32
+	// Compression is the algorithms able to decompress, in preference order
+	Compression []uint8
+	// HalfClose is whether half-close is supported
+	HalfClose bool
+	// Datagram is whether datagrams are framed by length, raw otherwise
+	Datagram bool
+}
+
+// Encode encodes the options, nil if empty.
+func (o *Options) Encode() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(Magic)
+
+	if o.Window != 0 {
+		value := make([]byte, 4)
+		binary.BigEndian.PutUint32(value, o.Window)
+		writeOption(buf, TypeWindow, value)
+	}
+
+	if len(o.Compression) != 0 {
+		writeOption(buf, TypeCompression, o.Compression)
+	}
+
+	if o.HalfClose {
+		writeOption(buf, TypeHalfClose, nil)
+	}
+
+	if o.Datagram {
+		writeOption(buf, TypeDatagram, nil)
+	}
+
+	if buf.Len() == len(Magic) {
+		return nil, nil
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the options, empty raw means no options.
+func (o *Options) Decode(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	if !bytes.HasPrefix(raw, Magic) {
+		return fmt.Errorf("invalid options magic")
+	}
+	raw = raw[len(Magic):]
+
+	for len(raw) != 0 {
+		if len(raw) < 2 {
+			return fmt.Errorf("invalid option header")
+		}
+
+		typ, length := raw[0], int(raw[1])
+		if len(raw) < 2+length {
+			return fmt.Errorf("invalid option(%d) length: %d", typ, length)
+		}
+		value := raw[2 : 2+length]
+		raw = raw[2+length:]
+
+		switch typ {
+		case TypeWindow:
+			if length != 4 {
+				return fmt.Errorf("invalid window length: %d", length)
+			}
+			o.Window = binary.BigEndian.Uint32(value)
+		case TypeCompression:
+			o.Compression = append([]uint8{}, value...)
+		case TypeHalfClose:
+			o.HalfClose = true
+		case TypeDatagram:
+			o.Datagram = true
+		default:
+			// unknown options are from newer peers
+		}
+	}
+
+	return nil
+}
+
+func writeOption(buf *bytes.Buffer, typ uint8, value []byte) {
+	buf.WriteByte(typ)
+	buf.WriteByte(byte(len(value)))
+	buf.Write(value)
+}
+
+// HandshakeLength returns the length of the encoded handshake request,
+// options start from there.
+func HandshakeLength(r *handshake.Request) int {
+	return socksz.LengthConnectionID +
+		socksz.LengthUserClientIDLength + len(r.TargetUserClientID) +
+		socksz.LengthTargetUserPairSignature +
+		socksz.LengthNetwork +
+		socksz.LengthATyp +
+		1 + len(r.DSTAddr) +
+		socksz.LengthDSTPort
+}
+
+// FromHandshake decodes the options after the decoded handshake request in raw,
+// nil if the source has no options.
+func FromHandshake(raw []byte, r *handshake.Request) (*Options, error) {
+	n := HandshakeLength(r)
+	if len(raw) <= n {
+		return nil, nil
+	}
+
+	options := &Options{}
+	if err := options.Decode(raw[n:]); err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
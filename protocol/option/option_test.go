@@ -0,0 +1,68 @@
+package option
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	options := &Options{
+		Window:      1 << 20,
+		Compression: []uint8{2, 1},
+		HalfClose:   true,
+		Datagram:    true,
+	}
+	raw, err := options.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &Options{}
+	if err := decoded.Decode(raw); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Window != options.Window || !bytes.Equal(decoded.Compression, options.Compression) ||
+		!decoded.HalfClose || !decoded.Datagram {
+		t.Fatalf("expect %+v, but got %+v", options, decoded)
+	}
+}
+
+func TestOptionsWithoutDatagram(t *testing.T) {
+	raw, err := (&Options{HalfClose: true}).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &Options{}
+	if err := decoded.Decode(raw); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Datagram {
+		t.Fatal("expect datagram unsupported")
+	}
+}
+
+func TestOptionsUnknown(t *testing.T) {
+	raw := append(append([]byte{}, Magic...), 0x7F, 2, 0xAA, 0xBB, TypeDatagram, 0)
+
+	decoded := &Options{}
+	if err := decoded.Decode(raw); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Datagram {
+		t.Fatal("expect datagram after unknown option")
+	}
+}
+
+func TestOptionsInvalid(t *testing.T) {
+	for _, raw := range [][]byte{
+		{0x00, 0x00},
+		append(append([]byte{}, Magic...), TypeWindow),
+		append(append([]byte{}, Magic...), TypeWindow, 4, 0x00),
+		append(append([]byte{}, Magic...), TypeWindow, 2, 0x00, 0x00),
+	} {
+		if err := (&Options{}).Decode(raw); err == nil {
+			t.Errorf("expect error for %x", raw)
+		}
+	}
+}
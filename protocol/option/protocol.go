@@ -0,0 +1,18 @@
+package option
+
+// Options DATA, appended after handshake request DATA (ignored by old decoders),
+// and at the end of settings DATA:
+//   MAGIC | TYPE | LENGTH | VALUE | TYPE | LENGTH | VALUE | ...
+//     2   |  1   |   1    |   -   |
+//
+//   MAGIC  - 0x47 0x5A ("GZ")
+//   TYPE   - 选项类型，未知类型忽略
+//   LENGTH - VALUE 长度
+//
+// TYPE:
+//   0x01 WINDOW      - 发送方接收窗口初始大小（字节），4 字节，网络字节序，0 表示不支持流控
+//   0x02 COMPRESSION - 发送方可解压的算法列表，每个 1 字节，按偏好排序，同 COMPRESS 字节
+//   0x03 HALF_CLOSE  - 发送方支持半关闭（CLOSE_WRITE），VALUE 为空
+//   0x04 DATAGRAM    - 发送方支持 UDP 数据报长度分帧（见 network/udp），VALUE 为空；
+//                      双方都支持时分帧，否则每次写入一个原始数据报
+//                      （目标方依据握手请求，源方依据 SETTINGS，未收到 SETTINGS 视为不支持）
@@ -0,0 +1,94 @@
+package p2p
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-zoox/gzfly/protocol"
+)
+
+// Answer is the answer to the offer of direct link
+type Answer struct {
+	PeerID      string
+	Status      uint8
+	Fingerprint []byte
+	Candidates  []string
+	// ExpiresAt is when the session of target ends (unix seconds), 0 if never, set by the relay
+	ExpiresAt int64
+	Message   string
+}
+
+// Encode encodes the data
+func (r *Answer) Encode() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	n, err := buf.WriteString(r.PeerID)
+	if n != protocol.LengthPeerID || err != nil {
+		return nil, fmt.Errorf("failed to write PeerID: %s", err)
+	}
+
+	err = buf.WriteByte(r.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Status: %s", err)
+	}
+
+	// rejected answers carry no certificate
+	fingerprint := r.Fingerprint
+	if fingerprint == nil {
+		fingerprint = make([]byte, protocol.LengthFingerprint)
+	}
+	if len(fingerprint) != protocol.LengthFingerprint {
+		return nil, fmt.Errorf("failed to write Fingerprint: length expect %d, but got %d", protocol.LengthFingerprint, len(fingerprint))
+	}
+	buf.Write(fingerprint)
+
+	if err := writeCandidates(buf, r.Candidates); err != nil {
+		return nil, fmt.Errorf("failed to write Candidates: %s", err)
+	}
+
+	writeExpires(buf, r.ExpiresAt)
+
+	_, err = buf.WriteString(r.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Message: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the data
+func (r *Answer) Decode(raw []byte) error {
+	reader := bytes.NewReader(raw)
+
+	buf, err := protocol.ReadFixed(reader, protocol.LengthPeerID)
+	if err != nil {
+		return fmt.Errorf("failed to read peer id: %s", err)
+	}
+	r.PeerID = string(buf)
+
+	if buf, err = protocol.ReadFixed(reader, protocol.LengthStatus); err != nil {
+		return fmt.Errorf("failed to read status: %s", err)
+	}
+	r.Status = buf[0]
+
+	if r.Fingerprint, err = protocol.ReadFixed(reader, protocol.LengthFingerprint); err != nil {
+		return fmt.Errorf("failed to read fingerprint: %s", err)
+	}
+
+	if r.Candidates, err = readCandidates(reader); err != nil {
+		return fmt.Errorf("failed to read candidates: %s", err)
+	}
+
+	if r.ExpiresAt, err = readExpires(reader); err != nil {
+		return fmt.Errorf("failed to read expires: %s", err)
+	}
+
+	buf, err = io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read message: %s", err)
+	}
+	r.Message = string(buf)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/go-zoox/gzfly/protocol"
+)
+
+// MaxCandidates is the max candidate addresses of one peer.
+const MaxCandidates = 255
+
+func writeCandidates(buf *bytes.Buffer, candidates []string) error {
+	if len(candidates) > MaxCandidates {
+		return fmt.Errorf("too many candidates: %d > %d", len(candidates), MaxCandidates)
+	}
+
+	buf.WriteByte(byte(len(candidates)))
+	for _, candidate := range candidates {
+		if err := protocol.WriteString(buf, candidate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readCandidates(reader io.Reader) ([]string, error) {
+	buf, err := protocol.ReadFixed(reader, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]string, int(buf[0]))
+	for i := range candidates {
+		if candidates[i], err = protocol.ReadString(reader); err != nil {
+			return nil, err
+		}
+	}
+
+	return candidates, nil
+}
+
+func writeExpires(buf *bytes.Buffer, expiresAt int64) {
+	value := make([]byte, protocol.LengthExpires)
+	binary.BigEndian.PutUint64(value, uint64(expiresAt))
+	buf.Write(value)
+}
+
+func readExpires(reader io.Reader) (int64, error) {
+	buf, err := protocol.ReadFixed(reader, protocol.LengthExpires)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(binary.BigEndian.Uint64(buf)), nil
+}
@@ -0,0 +1,119 @@
+package p2p
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/go-zoox/crypto/hmac"
+	"github.com/go-zoox/gzfly/protocol"
+)
+
+// Offer is the offer of direct link
+type Offer struct {
+	PeerID                  string
+	SourceUserClientID      string
+	TargetUserClientID      string
+	TargetUserPairSignature string
+	Fingerprint             []byte
+	Candidates              []string
+	// ExpiresAt is when the session of source ends (unix seconds), 0 if never, set by the relay
+	ExpiresAt int64
+	//
+	Secret string
+}
+
+// Encode encodes the data
+func (r *Offer) Encode() ([]byte, error) {
+	if r.Secret == "" {
+		return nil, fmt.Errorf("secret is required")
+	}
+
+	r.TargetUserPairSignature = r.sign()
+
+	buf := bytes.NewBuffer([]byte{})
+
+	n, err := buf.WriteString(r.PeerID)
+	if n != protocol.LengthPeerID {
+		return nil, fmt.Errorf("failed to write PeerID: length expect %d, but got %d", protocol.LengthPeerID, n)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to write PeerID: %s", err)
+	}
+
+	if err := protocol.WriteString(buf, r.SourceUserClientID); err != nil {
+		return nil, fmt.Errorf("failed to write SourceUserClientID: %s", err)
+	}
+
+	if err := protocol.WriteString(buf, r.TargetUserClientID); err != nil {
+		return nil, fmt.Errorf("failed to write TargetUserClientID: %s", err)
+	}
+
+	buf.WriteString(r.TargetUserPairSignature)
+
+	if len(r.Fingerprint) != protocol.LengthFingerprint {
+		return nil, fmt.Errorf("failed to write Fingerprint: length expect %d, but got %d", protocol.LengthFingerprint, len(r.Fingerprint))
+	}
+	buf.Write(r.Fingerprint)
+
+	if err := writeCandidates(buf, r.Candidates); err != nil {
+		return nil, fmt.Errorf("failed to write Candidates: %s", err)
+	}
+
+	writeExpires(buf, r.ExpiresAt)
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the data
+func (r *Offer) Decode(raw []byte) error {
+	reader := bytes.NewReader(raw)
+
+	buf, err := protocol.ReadFixed(reader, protocol.LengthPeerID)
+	if err != nil {
+		return fmt.Errorf("failed to read peer id: %s", err)
+	}
+	r.PeerID = string(buf)
+
+	if r.SourceUserClientID, err = protocol.ReadString(reader); err != nil {
+		return fmt.Errorf("failed to read source user client id: %s", err)
+	}
+
+	if r.TargetUserClientID, err = protocol.ReadString(reader); err != nil {
+		return fmt.Errorf("failed to read target user client id: %s", err)
+	}
+
+	if buf, err = protocol.ReadFixed(reader, protocol.LengthSignature); err != nil {
+		return fmt.Errorf("failed to read target user pair signature: %s", err)
+	}
+	r.TargetUserPairSignature = string(buf)
+
+	if r.Fingerprint, err = protocol.ReadFixed(reader, protocol.LengthFingerprint); err != nil {
+		return fmt.Errorf("failed to read fingerprint: %s", err)
+	}
+
+	if r.Candidates, err = readCandidates(reader); err != nil {
+		return fmt.Errorf("failed to read candidates: %s", err)
+	}
+
+	if r.ExpiresAt, err = readExpires(reader); err != nil {
+		return fmt.Errorf("failed to read expires: %s", err)
+	}
+
+	return nil
+}
+
+// Verify verifies the pair signature with Secret
+func (r *Offer) Verify() error {
+	if r.Secret == "" {
+		return fmt.Errorf("secret is required")
+	}
+
+	if r.TargetUserPairSignature != r.sign() {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+func (r *Offer) sign() string {
+	return hmac.Sha256(fmt.Sprintf("%s_%s", r.PeerID, r.TargetUserClientID), r.Secret)
+}
@@ -0,0 +1,28 @@
+package p2p
+
+// BASE:
+//  VER | CMD | CRYPTO | COMPRESS | DATA
+//   1  |  1  |  1     |   1      | -
+
+// Peer Offer DATA, from source to target through the relay:
+// 	PEER_ID | SOURCE_USER_CLIENT_ID | TARGET_USER_CLIENT_ID | TARGET_USER_PAIR_SIGNATURE | FINGERPRINT | CANDIDATES      | EXPIRES
+// 	  13    |       1 + -           |        1 + -          |            64              |     32      | 1 + (1 + -) * N |   8
+//
+//  PEER_ID                     - 直连 ID，与 CONNECTION_ID 同长度，源用户直连时作为凭证
+//  SOURCE_USER_CLIENT_ID       - 发起直连的用户 Client ID
+//  TARGET_USER_CLIENT_ID       - 目标用户 Client ID
+//  TARGET_USER_PAIR_SIGNATURE  - 目标用户配对签名，签名算法: HMAC_SHA256(PEER_ID + TARGET_USER_CLIENT_ID)
+//  FINGERPRINT                 - 源用户证书指纹，SHA256
+//  CANDIDATES                  - 源用户候选地址 (udp host:port)，中继会追加其观察到的地址
+//  EXPIRES                     - 源用户会话到期时间（Unix 秒，网络字节序），由中继填写，0 表示不过期；
+//                                令牌会话到期时目标用户关闭直连
+//
+// Peer Answer DATA, from target back to source through the relay:
+//   PEER_ID | STATUS | FINGERPRINT | CANDIDATES      | EXPIRES | MESSAGE
+//     13    |   1    |     32      | 1 + (1 + -) * N |    8    |  -
+//
+//   STATUS       - 直连状态，同 handshake，失败时源用户继续使用中继
+//   FINGERPRINT  - 目标用户证书指纹，源用户直连时校验
+//   CANDIDATES   - 目标用户候选地址，源用户逐一尝试直连
+//   EXPIRES      - 目标用户会话到期时间，同 Offer，到期时源用户关闭直连
+//   MESSAGE      - 错误信息
@@ -0,0 +1,25 @@
+package remotebind
+
+// BASE:
+//  VER | CMD | CRYPTO | COMPRESS | DATA
+//   1  |  1  |  1     |   1      | -
+
+// Remote Bind Request DATA:
+// 	BIND_ID | SOURCE_USER_CLIENT_ID | TARGET_USER_CLIENT_ID | TARGET_USER_PAIR_SIGNATURE | NETWORK | HOST     | PORT | BIND_SECRET
+// 	  13    |       1 + -           |        1 + -          |					    64             |    1    | 1 + -    |  2   |  1 + -
+//
+//  BIND_ID                     - 绑定 ID，与 CONNECTION_ID 同长度
+//  SOURCE_USER_CLIENT_ID       - 发起绑定的用户 Client ID，即连接回流的目标
+//  TARGET_USER_CLIENT_ID       - 目标用户 Client ID，在目标用户侧监听
+//  TARGET_USER_PAIR_SIGNATURE  - 目标用户配对签名，签名算法: HMAC_SHA256(BIND_ID + TARGET_USER_CLIENT_ID)
+//  NETWORK                     - 监听网络类型，同 handshake
+//  HOST                        - 目标用户侧监听地址
+//  PORT                        - 目标用户侧监听端口，2字节，网络字节序
+//  BIND_SECRET                 - 目标用户回连时的握手密钥，握手 DST.ADDR 为 BIND_ID
+//
+// Remote Bind Response DATA:
+//   BIND_ID | STATUS | MESSAGE
+//     13    |   1    |  -
+//
+//   STATUS 	- 绑定状态，同 handshake
+//   MESSAGE  - 错误信息
@@ -0,0 +1,131 @@
+package remotebind
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/go-zoox/crypto/hmac"
+	"github.com/go-zoox/gzfly/protocol"
+)
+
+// Request is the request for remote bind
+type Request struct {
+	BindID                  string
+	SourceUserClientID      string
+	TargetUserClientID      string
+	TargetUserPairSignature string
+	Network                 uint8
+	Host                    string
+	Port                    uint16
+	BindSecret              string
+	//
+	Secret string
+}
+
+// Encode encodes the data
+func (r *Request) Encode() ([]byte, error) {
+	if r.Secret == "" {
+		return nil, fmt.Errorf("secret is required")
+	}
+
+	r.TargetUserPairSignature = r.sign()
+
+	buf := bytes.NewBuffer([]byte{})
+
+	n, err := buf.WriteString(r.BindID)
+	if n != protocol.LengthBindID {
+		return nil, fmt.Errorf("failed to write BindID: length expect %d, but got %d", protocol.LengthBindID, n)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to write BindID: %s", err)
+	}
+
+	if err := protocol.WriteString(buf, r.SourceUserClientID); err != nil {
+		return nil, fmt.Errorf("failed to write SourceUserClientID: %s", err)
+	}
+
+	if err := protocol.WriteString(buf, r.TargetUserClientID); err != nil {
+		return nil, fmt.Errorf("failed to write TargetUserClientID: %s", err)
+	}
+
+	buf.WriteString(r.TargetUserPairSignature)
+
+	if err := buf.WriteByte(r.Network); err != nil {
+		return nil, fmt.Errorf("failed to write Network: %s", err)
+	}
+
+	if err := protocol.WriteString(buf, r.Host); err != nil {
+		return nil, fmt.Errorf("failed to write Host: %s", err)
+	}
+
+	portBytes := make([]byte, protocol.LengthPort)
+	binary.BigEndian.PutUint16(portBytes, r.Port)
+	buf.Write(portBytes)
+
+	if err := protocol.WriteString(buf, r.BindSecret); err != nil {
+		return nil, fmt.Errorf("failed to write BindSecret: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the data
+func (r *Request) Decode(raw []byte) error {
+	reader := bytes.NewReader(raw)
+
+	buf, err := protocol.ReadFixed(reader, protocol.LengthBindID)
+	if err != nil {
+		return fmt.Errorf("failed to read bind id: %s", err)
+	}
+	r.BindID = string(buf)
+
+	if r.SourceUserClientID, err = protocol.ReadString(reader); err != nil {
+		return fmt.Errorf("failed to read source user client id: %s", err)
+	}
+
+	if r.TargetUserClientID, err = protocol.ReadString(reader); err != nil {
+		return fmt.Errorf("failed to read target user client id: %s", err)
+	}
+
+	if buf, err = protocol.ReadFixed(reader, protocol.LengthSignature); err != nil {
+		return fmt.Errorf("failed to read target user pair signature: %s", err)
+	}
+	r.TargetUserPairSignature = string(buf)
+
+	if buf, err = protocol.ReadFixed(reader, 1); err != nil {
+		return fmt.Errorf("failed to read network: %s", err)
+	}
+	r.Network = buf[0]
+
+	if r.Host, err = protocol.ReadString(reader); err != nil {
+		return fmt.Errorf("failed to read host: %s", err)
+	}
+
+	if buf, err = protocol.ReadFixed(reader, protocol.LengthPort); err != nil {
+		return fmt.Errorf("failed to read port: %s", err)
+	}
+	r.Port = binary.BigEndian.Uint16(buf)
+
+	if r.BindSecret, err = protocol.ReadString(reader); err != nil {
+		return fmt.Errorf("failed to read bind secret: %s", err)
+	}
+
+	return nil
+}
+
+// Verify verifies the pair signature with Secret
+func (r *Request) Verify() error {
+	if r.Secret == "" {
+		return fmt.Errorf("secret is required")
+	}
+
+	if r.TargetUserPairSignature != r.sign() {
+		return fmt.Errorf("invalid signature")
+	}
+
+	return nil
+}
+
+func (r *Request) sign() string {
+	return hmac.Sha256(fmt.Sprintf("%s_%s", r.BindID, r.TargetUserClientID), r.Secret)
+}
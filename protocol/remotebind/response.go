@@ -0,0 +1,62 @@
+package remotebind
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-zoox/gzfly/protocol"
+)
+
+// Response represents the response
+type Response struct {
+	BindID  string
+	Status  uint8
+	Message string
+}
+
+// Encode encodes the data
+func (r *Response) Encode() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	n, err := buf.WriteString(r.BindID)
+	if n != protocol.LengthBindID || err != nil {
+		return nil, fmt.Errorf("failed to write BindID: %s", err)
+	}
+
+	err = buf.WriteByte(r.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Status: %s", err)
+	}
+
+	_, err = buf.WriteString(r.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Message: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the data
+func (r *Response) Decode(raw []byte) error {
+	reader := bytes.NewReader(raw)
+
+	buf, err := protocol.ReadFixed(reader, protocol.LengthBindID)
+	if err != nil {
+		return fmt.Errorf("failed to read bind id: %s", err)
+	}
+	r.BindID = string(buf)
+
+	if buf, err = protocol.ReadFixed(reader, protocol.LengthStatus); err != nil {
+		return fmt.Errorf("failed to read status: %s", err)
+	}
+	r.Status = buf[0]
+
+	buf, err = io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read message: %s", err)
+	}
+	r.Message = string(buf)
+
+	return nil
+}
@@ -0,0 +1,13 @@
+package settings
+
+// BASE:
+//  VER | CMD | CRYPTO | COMPRESS | DATA
+//   1  |  1  |  1     |   1      | -
+
+// Settings DATA, sent by target to source once the connection is accepted:
+//   CONNECTION_ID | STATUS | MESSAGE | OPTIONS
+//       13        |   1    |  1 + -  |  -
+//
+//   STATUS   - 连接状态，同 handshake
+//   MESSAGE  - 错误信息
+//   OPTIONS  - 目标侧选项，格式同 handshake 选项
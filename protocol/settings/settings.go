@@ -0,0 +1,79 @@
+package settings
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-zoox/gzfly/protocol"
+	"github.com/go-zoox/gzfly/protocol/option"
+)
+
+// Settings represents the settings of a connection
+type Settings struct {
+	ConnectionID string
+	Status       uint8
+	Message      string
+	Options      *option.Options
+}
+
+// Encode encodes the data
+func (r *Settings) Encode() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	n, err := buf.WriteString(r.ConnectionID)
+	if n != protocol.LengthConnectionID || err != nil {
+		return nil, fmt.Errorf("failed to write ConnectionID: %s", err)
+	}
+
+	err = buf.WriteByte(r.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write Status: %s", err)
+	}
+
+	if err := protocol.WriteString(buf, r.Message); err != nil {
+		return nil, fmt.Errorf("failed to write Message: %s", err)
+	}
+
+	if r.Options != nil {
+		options, err := r.Options.Encode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to write Options: %s", err)
+		}
+		buf.Write(options)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the data
+func (r *Settings) Decode(raw []byte) error {
+	reader := bytes.NewReader(raw)
+
+	buf, err := protocol.ReadFixed(reader, protocol.LengthConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to read connection id: %s", err)
+	}
+	r.ConnectionID = string(buf)
+
+	if buf, err = protocol.ReadFixed(reader, protocol.LengthStatus); err != nil {
+		return fmt.Errorf("failed to read status: %s", err)
+	}
+	r.Status = buf[0]
+
+	if r.Message, err = protocol.ReadString(reader); err != nil {
+		return fmt.Errorf("failed to read message: %s", err)
+	}
+
+	buf, err = io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read options: %s", err)
+	}
+
+	r.Options = &option.Options{}
+	if err := r.Options.Decode(buf); err != nil {
+		return fmt.Errorf("failed to read options: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package token
+
+// BASE:
+//  VER | CMD | CRYPTO | COMPRESS | DATA
+//   1  |  1  |  1     |   1      | -
+
+// Authenticate Token Request DATA, instead of the authenticate request of socksz:
+//   USER_CLIENT_ID | TOKEN
+//       1 + -      |   -
+//
+//   USER_CLIENT_ID - 用户 Client ID，须与 TOKEN 的 sub 一致
+//   TOKEN          - 中继签发的 JWT（HS256），声明:
+//                      sub     - 用户 Client ID
+//                      exp     - 过期时间，必填，过期后会话结束
+//                      aud     - 受众，中继配置时须一致
+//                      targets - 允许连接的用户 Client ID 列表，为空则不限制
+//
+// Response is the authenticate response of socksz: STATUS | MESSAGE
@@ -0,0 +1,48 @@
+package token
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/go-zoox/gzfly/protocol"
+)
+
+// Request represents the authenticate request by token
+type Request struct {
+	UserClientID string
+	Token        string
+}
+
+// Encode encodes the data
+func (r *Request) Encode() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	if err := protocol.WriteString(buf, r.UserClientID); err != nil {
+		return nil, fmt.Errorf("failed to write UserClientID: %s", err)
+	}
+
+	if _, err := buf.WriteString(r.Token); err != nil {
+		return nil, fmt.Errorf("failed to write Token: %s", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the data
+func (r *Request) Decode(raw []byte) error {
+	reader := bytes.NewReader(raw)
+
+	var err error
+	if r.UserClientID, err = protocol.ReadString(reader); err != nil {
+		return fmt.Errorf("failed to read user client id: %s", err)
+	}
+
+	buf, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read token: %s", err)
+	}
+	r.Token = string(buf)
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WriteString writes a string with 1 byte length prefix.
+func WriteString(buf *bytes.Buffer, s string) error {
+	if len(s) > 255 {
+		return fmt.Errorf("string too long: %d > 255", len(s))
+	}
+
+	if err := buf.WriteByte(byte(len(s))); err != nil {
+		return err
+	}
+
+	_, err := buf.WriteString(s)
+	return err
+}
+
+// ReadString reads a string with 1 byte length prefix.
+func ReadString(reader io.Reader) (string, error) {
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+
+	buf = make([]byte, int(buf[0]))
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+// ReadFixed reads exactly n bytes.
+func ReadFixed(reader io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,14 @@
+package window
+
+// BASE:
+//  VER | CMD | CRYPTO | COMPRESS | DATA
+//   1  |  1  |  1     |   1      | -
+
+// Window Update DATA, sent by the receiver once data is consumed:
+//   CONNECTION_ID | INCREMENT | SENT
+//       13        |    4      | (8)
+//
+//   INCREMENT - 新增发送额度（字节），网络字节序，0 表示确认支持流控
+//   SENT      - 可选，更新发送方开始按对方窗口限制发送前已发送的字节数，8 字节，网络字节序；
+//               带有 SENT 表示此后其发送量不超过 max(SENT, 窗口 + 已收到的 INCREMENT)，
+//               超出的连接由接收方关闭
@@ -0,0 +1,70 @@
+package window
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/go-zoox/gzfly/protocol"
+)
+
+// Update represents the window update
+type Update struct {
+	ConnectionID string
+	Increment    uint32
+	// Limited is whether the sender of update limits its sending by the window,
+	// Sent is the bytes it sent before that
+	Limited bool
+	Sent    uint64
+}
+
+// Encode encodes the data
+func (r *Update) Encode() ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	n, err := buf.WriteString(r.ConnectionID)
+	if n != protocol.LengthConnectionID || err != nil {
+		return nil, fmt.Errorf("failed to write ConnectionID: %s", err)
+	}
+
+	increment := make([]byte, protocol.LengthIncrement)
+	binary.BigEndian.PutUint32(increment, r.Increment)
+	buf.Write(increment)
+
+	if r.Limited {
+		sent := make([]byte, protocol.LengthSent)
+		binary.BigEndian.PutUint64(sent, r.Sent)
+		buf.Write(sent)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decode decodes the data
+func (r *Update) Decode(raw []byte) error {
+	reader := bytes.NewReader(raw)
+
+	buf, err := protocol.ReadFixed(reader, protocol.LengthConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to read connection id: %s", err)
+	}
+	r.ConnectionID = string(buf)
+
+	if buf, err = protocol.ReadFixed(reader, protocol.LengthIncrement); err != nil {
+		return fmt.Errorf("failed to read increment: %s", err)
+	}
+	r.Increment = binary.BigEndian.Uint32(buf)
+
+	// SENT is optional, absent from updates of old versions
+	if reader.Len() == 0 {
+		return nil
+	}
+
+	if buf, err = protocol.ReadFixed(reader, protocol.LengthSent); err != nil {
+		return fmt.Errorf("failed to read sent: %s", err)
+	}
+	r.Limited = true
+	r.Sent = binary.BigEndian.Uint64(buf)
+
+	return nil
+}
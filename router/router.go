@@ -0,0 +1,165 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/logger"
+)
+
+// Router decides the action per destination with rules loaded from a file,
+// the first matched rule wins.
+type Router struct {
+	sync.RWMutex
+
+	Path string
+	// Actions are the valid actions besides DIRECT and REJECT, such as PEER and names of targets,
+	// rules with other actions fail to load; nil accepts any action
+	Actions []string
+
+	rules   []*Rule
+	modTime time.Time
+}
+
+// New creates a router with the rules file, actions are the valid actions besides DIRECT and REJECT.
+func New(path string, actions ...string) (*Router, error) {
+	r := &Router{
+		Path:    path,
+		Actions: actions,
+	}
+
+	if err := r.Load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Parse parses rules, one per line, empty lines and lines starting with # are ignored.
+func Parse(content string) ([]*Rule, error) {
+	rules := []*Rule{}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		rule, err := ParseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rule.Line = line
+
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// Load (re)loads the rules file, the current rules are kept if it is invalid.
+func (r *Router) Load() error {
+	stat, err := os.Stat(r.Path)
+	if err != nil {
+		return fmt.Errorf("failed to stat rules(%s): %v", r.Path, err)
+	}
+
+	content, err := os.ReadFile(r.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read rules(%s): %v", r.Path, err)
+	}
+
+	rules, err := Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse rules(%s): %v", r.Path, err)
+	}
+
+	if r.Actions != nil {
+		for _, rule := range rules {
+			if !r.isValidAction(rule.Action) {
+				return fmt.Errorf("failed to load rules(%s): line %d: unknown action %s, available: %s", r.Path, rule.Line, rule.Action, strings.Join(append([]string{ActionDirect, ActionReject}, r.Actions...), ","))
+			}
+		}
+	}
+
+	r.Lock()
+	r.rules = rules
+	r.modTime = stat.ModTime()
+	r.Unlock()
+
+	logger.Info("[router] load %d rules from %s", len(rules), r.Path)
+	return nil
+}
+
+func (r *Router) isValidAction(action string) bool {
+	if action == ActionDirect || action == ActionReject {
+		return true
+	}
+
+	for _, a := range r.Actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watch reloads the rules file once it changes, it blocks, usually run in goroutine.
+func (r *Router) Watch(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+
+		stat, err := os.Stat(r.Path)
+		if err != nil {
+			logger.Warnf("[router] failed to stat rules(%s): %v", r.Path, err)
+			continue
+		}
+
+		r.RLock()
+		changed := !stat.ModTime().Equal(r.modTime)
+		r.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err := r.Load(); err != nil {
+			logger.Errorf("[router] failed to reload, keep the current rules: %v", err)
+
+			// do not retry until it changes again
+			r.Lock()
+			r.modTime = stat.ModTime()
+			r.Unlock()
+		}
+	}
+}
+
+// Match returns the first rule matches host:port, or nil.
+func (r *Router) Match(host string, port int) *Rule {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, rule := range r.rules {
+		if rule.Match(host, port) {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// Rules returns the current rules.
+func (r *Router) Rules() []*Rule {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.rules
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRules(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestNewActions(t *testing.T) {
+	cases := []struct {
+		name    string
+		rules   string
+		actions []string
+		err     string
+	}{
+		{"builtin", "DOMAIN,example.com,DIRECT\nMATCH,REJECT", []string{}, ""},
+		{"peer", "DOMAIN-SUFFIX,example.com,PEER", []string{ActionPeer}, ""},
+		{"named target", "IP-CIDR,10.0.0.0/8,office\nMATCH,PEER", []string{ActionPeer, "office"}, ""},
+		{"unknown target", "DOMAIN,example.com,DIRECT\nIP-CIDR,10.0.0.0/8,ofice", []string{ActionPeer, "office"}, "line 2: unknown action ofice"},
+		{"peer in egress", "MATCH,PEER", []string{ActionProxy}, "unknown action PEER"},
+		{"nil accepts any", "MATCH,anything", nil, ""},
+	}
+
+	for _, c := range cases {
+		_, err := New(writeRules(t, c.rules), c.actions...)
+		if c.err == "" && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: want error %q, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestLoadKeepsRulesOnUnknownAction(t *testing.T) {
+	path := writeRules(t, "DOMAIN,example.com,office")
+	r, err := New(path, "office")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("DOMAIN,example.com,home"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Load(); err == nil {
+		t.Fatal("want error of unknown action")
+	}
+
+	rule := r.Match("example.com", 443)
+	if rule == nil || rule.Action != "office" {
+		t.Fatalf("want the current rules kept, got %v", rule)
+	}
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Rule types, in the format of TYPE,VALUE,ACTION, except MATCH,ACTION.
+const (
+	// TypeDomain matches the exact domain
+	TypeDomain = "DOMAIN"
+	// TypeDomainSuffix matches the domain and its subdomains
+	TypeDomainSuffix = "DOMAIN-SUFFIX"
+	// TypeDomainKeyword matches domains containing the keyword
+	TypeDomainKeyword = "DOMAIN-KEYWORD"
+	// TypeIPCIDR matches IP hosts in the CIDR, domains are never resolved
+	TypeIPCIDR = "IP-CIDR"
+	// TypeDSTPort matches the destination port
+	TypeDSTPort = "DST-PORT"
+	// TypeMatch matches everything, usually the last rule
+	TypeMatch = "MATCH"
+)
+
+// Builtin actions, any other action is the name of a target, or a proxy in egress rules.
+const (
+	// ActionDirect dials the destination directly
+	ActionDirect = "DIRECT"
+	// ActionReject rejects the connection
+	ActionReject = "REJECT"
+	// ActionPeer uses the default target
+	ActionPeer = "PEER"
+	// ActionProxy uses the default upstream proxy, in egress rules
+	ActionProxy = "PROXY"
+)
+
+// Rule decides the action of destinations it matches.
+type Rule struct {
+	Type   string
+	Value  string
+	Action string
+	// Line is the line number in the rules file
+	Line int
+
+	cidr *net.IPNet
+	port int
+}
+
+// ParseRule parses a rule line, such as DOMAIN-SUFFIX,example.com,DIRECT.
+func ParseRule(line string) (*Rule, error) {
+	parts := strings.Split(line, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	rule := &Rule{
+		Type: strings.ToUpper(parts[0]),
+	}
+
+	if rule.Type == TypeMatch {
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid rule(%s), format: MATCH,ACTION", line)
+		}
+
+		rule.Action = parts[1]
+		return rule, nil
+	}
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid rule(%s), format: TYPE,VALUE,ACTION", line)
+	}
+	rule.Value, rule.Action = parts[1], parts[2]
+
+	switch rule.Type {
+	case TypeDomain, TypeDomainSuffix, TypeDomainKeyword:
+		rule.Value = strings.ToLower(strings.TrimSuffix(rule.Value, "."))
+	case TypeIPCIDR:
+		_, cidr, err := net.ParseCIDR(rule.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule(%s): %v", line, err)
+		}
+		rule.cidr = cidr
+	case TypeDSTPort:
+		port, err := strconv.Atoi(rule.Value)
+		if err != nil || port < 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid rule(%s): invalid port", line)
+		}
+		rule.port = port
+	default:
+		return nil, fmt.Errorf("invalid rule(%s): unknown type %s", line, rule.Type)
+	}
+
+	if rule.Action == "" {
+		return nil, fmt.Errorf("invalid rule(%s): action is required", line)
+	}
+
+	return rule, nil
+}
+
+// Match returns true if the destination host:port matches the rule.
+func (r *Rule) Match(host string, port int) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	switch r.Type {
+	case TypeDomain:
+		return host == r.Value
+	case TypeDomainSuffix:
+		return host == r.Value || strings.HasSuffix(host, "."+r.Value)
+	case TypeDomainKeyword:
+		return strings.Contains(host, r.Value)
+	case TypeIPCIDR:
+		ip := net.ParseIP(host)
+		return ip != nil && r.cidr.Contains(ip)
+	case TypeDSTPort:
+		return port == r.port
+	case TypeMatch:
+		return true
+	default:
+		return false
+	}
+}
+
+func (r *Rule) String() string {
+	if r.Type == TypeMatch {
+		return fmt.Sprintf("%s,%s", r.Type, r.Action)
+	}
+
+	return fmt.Sprintf("%s,%s,%s", r.Type, r.Value, r.Action)
+}
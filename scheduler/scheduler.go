@@ -0,0 +1,257 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Class is the priority class of a queue, higher class gets more bandwidth.
+type Class uint8
+
+// Priority classes, the weight is the multiple of quantum per round.
+const (
+	ClassLow    Class = 1
+	ClassNormal Class = 2
+	ClassHigh   Class = 4
+)
+
+// DefaultQuantum is the bytes a normal queue may send per round (weighted by class),
+// a bulk transfer sends about one frame per round, so small frames of
+// interactive connections never wait behind it.
+const DefaultQuantum = 16 * 1024
+
+// DefaultQueueSize is the max frames queued per connection.
+const DefaultQueueSize = 64
+
+// ErrClosed is returned once the scheduler is closed.
+var ErrClosed = errors.New("scheduler is closed")
+
+// ErrCanceled is returned by Push once it gives up waiting.
+var ErrCanceled = errors.New("push is canceled")
+
+// ParseClass parses the class name: low, normal or high.
+func ParseClass(name string) (Class, error) {
+	switch strings.ToLower(name) {
+	case "low":
+		return ClassLow, nil
+	case "", "normal":
+		return ClassNormal, nil
+	case "high":
+		return ClassHigh, nil
+	default:
+		return 0, fmt.Errorf("unknown priority class: %s, only support low/normal/high", name)
+	}
+}
+
+func (c Class) String() string {
+	switch c {
+	case ClassLow:
+		return "low"
+	case ClassNormal:
+		return "normal"
+	case ClassHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("unknown(%d)", c)
+	}
+}
+
+type queue struct {
+	id      string
+	class   Class
+	frames  [][]byte
+	deficit int
+	visited bool
+}
+
+// Scheduler interleaves frames of connections fairly with deficit round robin,
+// frames of one connection keep in order.
+//
+// Frames without connection, such as requests of remote bind, are sent first.
+type Scheduler struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	Quantum   int
+	QueueSize int
+	//
+	control [][]byte
+	queues  map[string]*queue
+	// active queues with frames, in round robin order
+	active []*queue
+	closed bool
+}
+
+// New creates a scheduler, queueSize is the max frames queued per connection.
+func New(queueSize int) *Scheduler {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	s := &Scheduler{
+		Quantum:   DefaultQuantum,
+		QueueSize: queueSize,
+		queues:    map[string]*queue{},
+	}
+	s.cond = sync.NewCond(&s.Mutex)
+	return s
+}
+
+// Push queues the frame of connection id, or a control frame if id is empty.
+// It blocks while the queue is full if bounded, frames such as close should be
+// unbounded so that they are never blocked by the data before them.
+// The wait gives up with ErrCanceled once any of cancel is closed, such as
+// the write deadline of connection.
+func (s *Scheduler) Push(id string, class Class, frame []byte, bounded bool, cancel ...<-chan struct{}) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	if id == "" {
+		s.control = append(s.control, frame)
+		s.cond.Broadcast()
+		return nil
+	}
+
+	var stop chan struct{}
+	for bounded {
+		q, ok := s.queues[id]
+		if !ok || len(q.frames) < s.QueueSize {
+			break
+		}
+
+		for _, ch := range cancel {
+			select {
+			case <-ch:
+				return ErrCanceled
+			default:
+			}
+		}
+
+		if stop == nil && len(cancel) != 0 {
+			stop = make(chan struct{})
+			defer close(stop)
+			s.wakeOn(stop, cancel)
+		}
+
+		s.cond.Wait()
+		if s.closed {
+			return ErrClosed
+		}
+	}
+
+	q, ok := s.queues[id]
+	if !ok {
+		q = &queue{id: id}
+		s.queues[id] = q
+		s.active = append(s.active, q)
+	}
+	if class != 0 {
+		q.class = class
+	}
+	q.frames = append(q.frames, frame)
+
+	s.cond.Broadcast()
+	return nil
+}
+
+// wakeOn wakes up waits once any of cancel is closed, until stop.
+func (s *Scheduler) wakeOn(stop <-chan struct{}, cancel []<-chan struct{}) {
+	for _, ch := range cancel {
+		go func(ch <-chan struct{}) {
+			select {
+			case <-ch:
+				s.Lock()
+				s.cond.Broadcast()
+				s.Unlock()
+			case <-stop:
+			}
+		}(ch)
+	}
+}
+
+// Next returns the next frame to send, it blocks until any frame is queued.
+func (s *Scheduler) Next() ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for {
+		if s.closed {
+			return nil, ErrClosed
+		}
+
+		if len(s.control) != 0 {
+			frame := s.control[0]
+			s.control[0] = nil
+			s.control = s.control[1:]
+			return frame, nil
+		}
+
+		if len(s.active) == 0 {
+			s.cond.Wait()
+			continue
+		}
+
+		q := s.active[0]
+		if !q.visited {
+			class := q.class
+			if class == 0 {
+				class = ClassNormal
+			}
+
+			q.deficit += s.Quantum * int(class) / int(ClassNormal)
+			q.visited = true
+		}
+
+		frame := q.frames[0]
+		if len(frame) > q.deficit {
+			// wait for the next round
+			q.visited = false
+			s.active = append(s.active[1:], q)
+			continue
+		}
+
+		q.deficit -= len(frame)
+		q.frames[0] = nil
+		q.frames = q.frames[1:]
+		if len(q.frames) == 0 {
+			// idle queues keep no deficit, and are dropped until next push
+			delete(s.queues, q.id)
+			s.active = s.active[1:]
+		}
+
+		// wake up pushes waiting for space
+		s.cond.Broadcast()
+		return frame, nil
+	}
+}
+
+// Len returns the frames queued.
+func (s *Scheduler) Len() int {
+	s.Lock()
+	defer s.Unlock()
+
+	n := len(s.control)
+	for _, q := range s.active {
+		n += len(q.frames)
+	}
+	return n
+}
+
+// Close stops the scheduler, queued frames are dropped.
+func (s *Scheduler) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.closed = true
+	s.control = nil
+	s.queues = map[string]*queue{}
+	s.active = nil
+	s.cond.Broadcast()
+	return nil
+}
@@ -0,0 +1,186 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Endpoint is one udp socket both accepting and dialing direct quic links between peers,
+// links are dialed from the port peers know, so that outgoing packets open NAT for them.
+// Peers verify each other out of band: the dialer pins the certificate by Fingerprint,
+// and tells the listener who it is in the request, see ReadRequest.
+type Endpoint struct {
+	transport *quic.Transport
+	listener  *quic.Listener
+	stream    StreamFunc
+	// Fingerprint is the sha256 of the self-signed certificate of the endpoint
+	Fingerprint []byte
+}
+
+// ListenEndpoint listens the udp address for direct links, such as 0.0.0.0:0.
+func ListenEndpoint(address string, stream StreamFunc) (*Endpoint, error) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen udp endpoint: %v", err)
+	}
+
+	tr := &quic.Transport{Conn: conn}
+	listener, err := tr.Listen(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{ALPN},
+	}, quicConfig())
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to listen udp endpoint: %v", err)
+	}
+
+	fingerprint := sha256.Sum256(cert.Certificate[0])
+	return &Endpoint{
+		transport:   tr,
+		listener:    listener,
+		stream:      stream,
+		Fingerprint: fingerprint[:],
+	}, nil
+}
+
+// Addr returns the udp address listened.
+func (e *Endpoint) Addr() *net.UDPAddr {
+	return e.transport.Conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Candidates returns the addresses peers may reach the endpoint at, all addresses
+// of interfaces if it listens on any address.
+func (e *Endpoint) Candidates() []string {
+	addr := e.Addr()
+	port := fmt.Sprintf("%d", addr.Port)
+	if !addr.IP.IsUnspecified() {
+		return []string{net.JoinHostPort(addr.IP.String(), port)}
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+
+	candidates := []string{}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLinkLocalUnicast() || ipnet.IP.IsMulticast() {
+			continue
+		}
+
+		candidates = append(candidates, net.JoinHostPort(ipnet.IP.String(), port))
+	}
+
+	return candidates
+}
+
+// Accept accepts the next link dialed by peers.
+func (e *Endpoint) Accept() (Conn, error) {
+	conn, err := e.listener.Accept(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return newQUICConn(conn, e.stream), nil
+}
+
+// Dial connects to the endpoint of peer at address, whose certificate must match fingerprint,
+// the listener waits for the request of WriteRequest to accept the link.
+func (e *Endpoint) Dial(ctx context.Context, address string, fingerprint []byte) (Conn, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := e.transport.Dial(ctx, addr, &tls.Config{
+		// the certificate is self-signed, it is verified by fingerprint instead
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no certificate")
+			}
+
+			actual := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(actual[:], fingerprint) {
+				return fmt.Errorf("certificate fingerprint mismatch")
+			}
+
+			return nil
+		},
+		NextProtos: []string{ALPN},
+	}, quicConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	return newQUICConn(conn, e.stream), nil
+}
+
+// Punch sends a packet to address from the endpoint, so that NAT in front of it
+// accepts links dialed from address afterwards, the packet is dropped by peer.
+func (e *Endpoint) Punch(address string) error {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.transport.WriteTo([]byte{0}, addr)
+	return err
+}
+
+// Close closes the endpoint and links of it.
+func (e *Endpoint) Close() error {
+	e.listener.Close()
+	return e.transport.Close()
+}
+
+// selfSignedCertificate creates a certificate for the lifetime of the process.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: ALPN},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/gorilla/websocket"
+)
+
+// MaxMessageSize is the max DATA length of one frame of tls, h2 and quic links.
+const MaxMessageSize = 16 << 20
+
+// Frames of tls, h2 and quic links:
+//
+//	TYPE | LENGTH | DATA
+//	 1   |   4    | LENGTH
+//
+// TYPE is the websocket message type, LENGTH is big endian.
+const lengthFrameHeader = 5
+
+// writeFrame writes one message as a frame, in a single write.
+func writeFrame(w io.Writer, messageType int, data []byte) error {
+	if len(data) > MaxMessageSize {
+		return fmt.Errorf("message too large: %d > %d", len(data), MaxMessageSize)
+	}
+
+	frame := make([]byte, lengthFrameHeader+len(data))
+	frame[0] = byte(messageType)
+	binary.BigEndian.PutUint32(frame[1:lengthFrameHeader], uint32(len(data)))
+	copy(frame[lengthFrameHeader:], data)
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// readFrame reads one frame, io.EOF only if r ends between frames.
+func readFrame(r io.Reader) (int, []byte, error) {
+	header := make([]byte, lengthFrameHeader)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > MaxMessageSize {
+		return 0, nil, fmt.Errorf("message too large: %d > %d", length, MaxMessageSize)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	return int(header[0]), data, nil
+}
+
+// closeError returns the error of reading a link as websocket does,
+// a link ended without close message is an abnormal closure.
+func closeError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}
+	}
+
+	return err
+}
+
+// closeMessageError returns the error of reading a close message.
+func closeMessageError(data []byte) error {
+	if len(data) < 2 {
+		return &websocket.CloseError{Code: websocket.CloseNoStatusReceived}
+	}
+
+	return &websocket.CloseError{
+		Code: int(binary.BigEndian.Uint16(data)),
+		Text: string(data[2:]),
+	}
+}
@@ -0,0 +1,269 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// h2Stream is one http/2 stream as a connection, framed as tls links,
+// the client writes the request body and reads the response body, the relay the reverse.
+type h2Stream struct {
+	io.Reader
+	writer io.Writer
+	// flush sends what is written, nil if writes are sent as they are
+	flush func()
+	// close ends the stream, once
+	close     func()
+	closeOnce sync.Once
+	// mu keeps writes away from the end of the stream
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+	//
+	local  net.Addr
+	remote net.Addr
+	tls    *tls.ConnectionState
+}
+
+func (s *h2Stream) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, net.ErrClosed
+	}
+
+	n, err := s.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+
+	if s.flush != nil {
+		s.flush()
+	}
+
+	return n, nil
+}
+
+func (s *h2Stream) Close() error {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		s.close()
+		close(s.done)
+	})
+
+	return nil
+}
+
+func (s *h2Stream) LocalAddr() net.Addr {
+	return s.local
+}
+
+func (s *h2Stream) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+// deadlines are not used by framedConn
+
+func (s *h2Stream) SetDeadline(t time.Time) error {
+	return fmt.Errorf("h2 stream does not support deadlines")
+}
+
+func (s *h2Stream) SetReadDeadline(t time.Time) error {
+	return s.SetDeadline(t)
+}
+
+func (s *h2Stream) SetWriteDeadline(t time.Time) error {
+	return s.SetDeadline(t)
+}
+
+// dialH2 connects to the relay by a POST stream of http/2 over tls, through the proxy of cfg if any,
+// the request goes to the path of u as https, with the headers of cfg.
+func dialH2(u *url.URL, cfg *DialConfig) (Conn, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:               cfg.Proxy,
+			TLSClientConfig:     clientTLS(cfg.TLS, u.Hostname(), "h2"),
+			TLSHandshakeTimeout: HandshakeTimeout,
+			ForceAttemptHTTP2:   true,
+		},
+	}
+
+	target := *u
+	target.Scheme = "https"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var local, remote net.Addr
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			local, remote = info.Conn.LocalAddr(), info.Conn.RemoteAddr()
+		},
+	})
+
+	body, writer := io.Pipe()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, target.String(), body)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	for key, values := range cfg.Header {
+		request.Header[key] = values
+	}
+
+	// headers come back once the relay accepts the stream
+	timer := time.AfterFunc(HandshakeTimeout, cancel)
+	response, err := client.Do(request)
+	timer.Stop()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to connect h2 at %s (error: %s)", u.Host, err)
+	}
+
+	if response.ProtoMajor != 2 || response.StatusCode != http.StatusOK {
+		response.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("failed to connect h2 at %s (status: %s, proto: %s)", u.Host, response.Status, response.Proto)
+	}
+
+	link := newFramedConn(&h2Stream{
+		Reader: response.Body,
+		writer: writer,
+		close: func() {
+			writer.Close()
+			cancel()
+			response.Body.Close()
+			client.CloseIdleConnections()
+		},
+		done:   make(chan struct{}),
+		local:  local,
+		remote: remote,
+		tls:    response.TLS,
+	})
+	if err := WriteRequest(link, u); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// h2Listener accepts POST streams of http/2 as links, on any path,
+// the path requested is sent again as the first message, see ReadRequest.
+type h2Listener struct {
+	listener net.Listener
+	server   *http.Server
+	streams  chan *h2Stream
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func listenH2(u *url.URL, cfg *ListenConfig) (Listener, error) {
+	tlsCfg := cfg.TLS.Clone()
+	tlsCfg.NextProtos = []string{"h2"}
+
+	listener, err := tls.Listen("tcp", u.Host, tlsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen h2 transport: %v", err)
+	}
+
+	l := &h2Listener{
+		listener: listener,
+		streams:  make(chan *h2Stream),
+		closed:   make(chan struct{}),
+	}
+	l.server = &http.Server{
+		Handler:           http.HandlerFunc(l.serveHTTP),
+		TLSConfig:         tlsCfg,
+		ReadHeaderTimeout: HandshakeTimeout,
+	}
+
+	go l.server.Serve(listener)
+
+	return l, nil
+}
+
+func (l *h2Listener) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 {
+		http.Error(w, "http/2 required", http.StatusHTTPVersionNotSupported)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	local, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	remote, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		return
+	}
+
+	stream := &h2Stream{
+		Reader: r.Body,
+		writer: w,
+		flush:  flusher.Flush,
+		close: func() {
+			r.Body.Close()
+		},
+		done:   make(chan struct{}),
+		local:  local,
+		remote: remote,
+		tls:    r.TLS,
+	}
+
+	select {
+	case l.streams <- stream:
+	case <-l.closed:
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	// the response ends once the handler returns, writes are stopped before
+	select {
+	case <-stream.done:
+	case <-r.Context().Done():
+		stream.Close()
+	}
+}
+
+func (l *h2Listener) Accept() (Conn, error) {
+	select {
+	case stream := <-l.streams:
+		return newFramedConn(stream), nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *h2Listener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+
+	return l.server.Close()
+}
+
+func (l *h2Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
@@ -0,0 +1,231 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/quic-go/quic-go"
+)
+
+// MaxStreams is the max unidirectional streams a peer may open at the same time,
+// about one per connection in flight.
+const MaxStreams = 1 << 16
+
+// maxStreams is MaxStreams, lowered by tests
+var maxStreams int64 = MaxStreams
+
+// quicConn is a link of quic, each side writes the frames of one connection on its own
+// unidirectional stream, so that a lost packet only stalls the connection it belongs to.
+type quicConn struct {
+	conn   quic.Connection
+	stream StreamFunc
+	// mu guards streams and keeps concurrent frames whole
+	mu      sync.Mutex
+	streams map[string]quic.SendStream
+	// messages are read from all streams of peer
+	messages chan message
+}
+
+type message struct {
+	typ  int
+	data []byte
+}
+
+func newQUICConn(conn quic.Connection, stream StreamFunc) *quicConn {
+	c := &quicConn{
+		conn:     conn,
+		stream:   stream,
+		streams:  map[string]quic.SendStream{},
+		messages: make(chan message, 64),
+	}
+
+	go c.acceptStreams()
+	return c
+}
+
+func quicConfig() *quic.Config {
+	return &quic.Config{
+		HandshakeIdleTimeout:  HandshakeTimeout,
+		KeepAlivePeriod:       15 * time.Second,
+		MaxIncomingUniStreams: maxStreams,
+	}
+}
+
+// acceptStreams reads each stream opened by peer, until the link is closed.
+func (c *quicConn) acceptStreams() {
+	for {
+		s, err := c.conn.AcceptUniStream(context.Background())
+		if err != nil {
+			return
+		}
+
+		go c.readStream(s)
+	}
+}
+
+func (c *quicConn) readStream(s quic.ReceiveStream) {
+	reader := bufio.NewReader(s)
+	for {
+		mt, data, err := readFrame(reader)
+		if err != nil {
+			s.CancelRead(0)
+			return
+		}
+
+		// the last frame of peer ends the connection, so does the stream of it here,
+		// the side receiving a close writes nothing more
+		if c.stream != nil && mt == BinaryMessage {
+			if key, last := c.stream(data); last && key != "" {
+				c.closeStream(key)
+			}
+		}
+
+		select {
+		case c.messages <- message{mt, data}:
+		case <-c.conn.Context().Done():
+			return
+		}
+	}
+}
+
+func (c *quicConn) ReadMessage() (int, []byte, error) {
+	for {
+		select {
+		case m := <-c.messages:
+			switch m.typ {
+			case PingMessage, PongMessage:
+			case CloseMessage:
+				return 0, nil, closeMessageError(m.data)
+			default:
+				return m.typ, m.data, nil
+			}
+		case <-c.conn.Context().Done():
+			return 0, nil, c.closeError()
+		}
+	}
+}
+
+// closeError returns the error of reading a closed link as websocket does.
+func (c *quicConn) closeError() error {
+	cause := context.Cause(c.conn.Context())
+
+	var appErr *quic.ApplicationError
+	if errors.As(cause, &appErr) && !appErr.Remote {
+		return net.ErrClosed
+	}
+
+	return &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: cause.Error()}
+}
+
+// WriteMessage writes the frame on the stream chosen by StreamFunc,
+// pings are not sent as quic keeps the link alive itself.
+func (c *quicConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == PingMessage || messageType == PongMessage {
+		return nil
+	}
+
+	key, last := "", false
+	if c.stream != nil && messageType == BinaryMessage {
+		key, last = c.stream(data)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.streams[key]
+	if !ok {
+		var err error
+		if s, err = c.conn.OpenUniStreamSync(c.conn.Context()); err != nil {
+			return err
+		}
+		c.streams[key] = s
+	}
+
+	if err := writeFrame(s, messageType, data); err != nil {
+		delete(c.streams, key)
+		s.CancelWrite(0)
+		return err
+	}
+
+	if last && key != "" {
+		delete(c.streams, key)
+		return s.Close()
+	}
+
+	return nil
+}
+
+// closeStream closes the stream of key written by this side, if any.
+func (c *quicConn) closeStream(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.streams[key]; ok {
+		delete(c.streams, key)
+		s.Close()
+	}
+}
+
+func (c *quicConn) Close() error {
+	return c.conn.CloseWithError(0, "")
+}
+
+func (c *quicConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *quicConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// dialQUIC connects to the relay by quic, proxies are not supported.
+func dialQUIC(u *url.URL, cfg *DialConfig) (Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+
+	conn, err := quic.DialAddr(ctx, u.Host, clientTLS(cfg.TLS, u.Hostname(), ALPN), quicConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect quic at %s (error: %s)", u.Host, err)
+	}
+
+	link := newQUICConn(conn, cfg.Stream)
+	if err := WriteRequest(link, u); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// quicListener accepts links of quic.
+type quicListener struct {
+	*quic.Listener
+	stream StreamFunc
+}
+
+func listenQUIC(u *url.URL, cfg *ListenConfig) (Listener, error) {
+	tlsCfg := cfg.TLS.Clone()
+	tlsCfg.NextProtos = []string{ALPN}
+
+	listener, err := quic.ListenAddr(u.Host, tlsCfg, quicConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen quic transport: %v", err)
+	}
+
+	return &quicListener{listener, cfg.Stream}, nil
+}
+
+func (l *quicListener) Accept() (Conn, error) {
+	conn, err := l.Listener.Accept(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	return newQUICConn(conn, l.stream), nil
+}
@@ -0,0 +1,137 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/gzfly/network/upstream"
+)
+
+// ALPN is the application protocol of tls and quic links.
+const ALPN = "gzfly"
+
+// HandshakeTimeout limits connecting and the tls handshake, same as websocket.DefaultDialer.
+const HandshakeTimeout = 45 * time.Second
+
+// framedConn is a link of frames over one tls connection.
+type framedConn struct {
+	net.Conn
+	reader *bufio.Reader
+	// writeMu keeps concurrent frames whole, pongs are written while reading
+	writeMu sync.Mutex
+}
+
+func newFramedConn(conn net.Conn) *framedConn {
+	return &framedConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (c *framedConn) ReadMessage() (int, []byte, error) {
+	for {
+		mt, data, err := readFrame(c.reader)
+		if err != nil {
+			return 0, nil, closeError(err)
+		}
+
+		switch mt {
+		case PingMessage:
+			if err := c.WriteMessage(PongMessage, data); err != nil {
+				return 0, nil, err
+			}
+		case PongMessage:
+		case CloseMessage:
+			return 0, nil, closeMessageError(data)
+		default:
+			return mt, data, nil
+		}
+	}
+}
+
+func (c *framedConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return writeFrame(c.Conn, messageType, data)
+}
+
+// dialTLS connects to the relay by tls, through the proxy of cfg if any.
+func dialTLS(u *url.URL, cfg *DialConfig) (Conn, error) {
+	conn, err := dialProxy(u, cfg.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect tls at %s (error: %s)", u.Host, err)
+	}
+
+	tlsConn := tls.Client(conn, clientTLS(cfg.TLS, u.Hostname(), ALPN))
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect tls at %s (error: %s)", u.Host, err)
+	}
+
+	link := newFramedConn(tlsConn)
+	if err := WriteRequest(link, u); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+// dialProxy connects to the host of u, through the proxy chosen by proxy if any.
+func dialProxy(u *url.URL, proxy func(*http.Request) (*url.URL, error)) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: HandshakeTimeout}
+	if proxy == nil {
+		return dialer.Dial("tcp", u.Host)
+	}
+
+	// proxies are chosen as of the https request to the relay
+	proxyURL, err := proxy(&http.Request{URL: &url.URL{Scheme: "https", Host: u.Host}})
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return dialer.Dial("tcp", u.Host)
+	}
+
+	p, err := upstream.Parse(proxyURL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return p.Dial(dialer.Dial, "tcp", u.Host, HandshakeTimeout)
+}
+
+// tlsListener accepts links of tls, the handshake happens on the first read.
+type tlsListener struct {
+	net.Listener
+}
+
+func listenTLS(u *url.URL, cfg *ListenConfig) (Listener, error) {
+	tlsCfg := cfg.TLS.Clone()
+	tlsCfg.NextProtos = []string{ALPN}
+
+	listener, err := tls.Listen("tcp", u.Host, tlsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen tls transport: %v", err)
+	}
+
+	return &tlsListener{listener}, nil
+}
+
+func (l *tlsListener) Accept() (Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return newFramedConn(conn), nil
+}
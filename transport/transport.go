@@ -0,0 +1,184 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// Message types, same as websocket, so that links of any transport are read alike.
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+	CloseMessage  = websocket.CloseMessage
+	PingMessage   = websocket.PingMessage
+	PongMessage   = websocket.PongMessage
+)
+
+// Conn is one link between a client and the relay, carrying whole socksz frames.
+// It behaves as *websocket.Conn: pings are answered by the transport and never read,
+// and reading a closed link returns *websocket.CloseError.
+type Conn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	Close() error
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// Listener accepts links of clients, websocket links are accepted by the http server instead.
+type Listener interface {
+	Accept() (Conn, error)
+	Close() error
+	Addr() net.Addr
+}
+
+// StreamFunc returns the stream of frame for multiplexed transports (quic), frames of
+// the same key keep their order, empty key is the control stream. last is true if no
+// more frames of the key are expected, such as close of a connection.
+type StreamFunc func(frame []byte) (key string, last bool)
+
+// DialConfig configures how links are dialed.
+type DialConfig struct {
+	// TLS is used by wss, tls, h2 and quic, ServerName defaults to the host of url
+	TLS *tls.Config
+	// Proxy returns the proxy to reach the relay through, nil connects directly,
+	// quic is never proxied
+	Proxy func(*http.Request) (*url.URL, error)
+	// Header is the extra headers of the websocket upgrade and the h2 request
+	Header http.Header
+	// Stream chooses the stream of frames written, see StreamFunc
+	Stream StreamFunc
+}
+
+// ListenConfig configures how links are accepted.
+type ListenConfig struct {
+	// TLS is the certificate of the relay, required by tls, h2 and quic,
+	// ClientCAs verifies client certificates, see PeerCertificate
+	TLS *tls.Config
+	// Stream chooses the stream of frames written, see StreamFunc
+	Stream StreamFunc
+}
+
+// Dial connects to the relay at u, the transport is chosen by scheme:
+// ws and wss are websocket, tls is length framed TCP+TLS, h2 is the same frames
+// on a POST stream of http/2, quic is one stream per connection.
+// The path and query of u are sent to the relay, see ReadRequest.
+func Dial(u *url.URL, cfg *DialConfig) (Conn, error) {
+	if cfg == nil {
+		cfg = &DialConfig{}
+	}
+
+	switch u.Scheme {
+	case "ws", "wss":
+		return dialWebSocket(u, cfg)
+	case "tls":
+		return dialTLS(u, cfg)
+	case "h2":
+		return dialH2(u, cfg)
+	case "quic":
+		return dialQUIC(u, cfg)
+	default:
+		return nil, fmt.Errorf("unknown transport: %s, only support ws/wss/tls/h2/quic", u.Scheme)
+	}
+}
+
+// Listen accepts links at the address of u, such as tls://:6443, h2://:8443 or quic://0.0.0.0:6443.
+func Listen(u *url.URL, cfg *ListenConfig) (Listener, error) {
+	if cfg == nil || cfg.TLS == nil {
+		return nil, fmt.Errorf("transport %s requires a certificate", u.Scheme)
+	}
+
+	switch u.Scheme {
+	case "tls":
+		return listenTLS(u, cfg)
+	case "h2":
+		return listenH2(u, cfg)
+	case "quic":
+		return listenQUIC(u, cfg)
+	default:
+		return nil, fmt.Errorf("unknown transport: %s, only support tls/h2/quic", u.Scheme)
+	}
+}
+
+// ReadRequest reads the path and query sent by Dial, the first message of tls, h2 and quic links,
+// websocket links carry them in the upgrade request instead.
+func ReadRequest(conn Conn) (*url.URL, error) {
+	mt, message, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	if mt != TextMessage {
+		return nil, fmt.Errorf("invalid request: unexpected message type %d", mt)
+	}
+
+	u, err := url.ParseRequestURI(string(message))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+
+	return u, nil
+}
+
+// WriteRequest writes the path and query of u as the first message, see ReadRequest.
+func WriteRequest(conn Conn, u *url.URL) error {
+	if err := conn.WriteMessage(TextMessage, []byte(u.RequestURI())); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to write request: %v", err)
+	}
+
+	return nil
+}
+
+// PeerCertificate returns the verified certificate of peer of tls, h2 and quic links,
+// nil if peer sent none or the link is websocket. It is known once the request is read.
+func PeerCertificate(conn Conn) *x509.Certificate {
+	var state tls.ConnectionState
+	switch c := conn.(type) {
+	case *framedConn:
+		switch conn := c.Conn.(type) {
+		case *tls.Conn:
+			state = conn.ConnectionState()
+		case *h2Stream:
+			if conn.tls == nil {
+				return nil
+			}
+			state = *conn.tls
+		default:
+			return nil
+		}
+	case *quicConn:
+		state = c.conn.ConnectionState().TLS
+	default:
+		return nil
+	}
+
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return state.VerifiedChains[0][0]
+}
+
+// clientTLS returns a copy of cfg for host, speaking protos.
+func clientTLS(cfg *tls.Config, host string, protos ...string) *tls.Config {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	if protos != nil {
+		cfg.NextProtos = protos
+	}
+
+	return cfg
+}
@@ -0,0 +1,205 @@
+package transport
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestTransports(t *testing.T) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scheme := range []string{"tls", "h2", "quic"} {
+		t.Run(scheme, func(t *testing.T) {
+			listener, err := Listen(&url.URL{Scheme: scheme, Host: "127.0.0.1:0"}, &ListenConfig{
+				TLS: &tls.Config{Certificates: []tls.Certificate{cert}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			accepted := accept(listener)
+
+			u := &url.URL{Scheme: scheme, Host: listener.Addr().String(), Path: "/ws", RawQuery: "session=1"}
+			client, err := Dial(u, &DialConfig{
+				TLS: &tls.Config{InsecureSkipVerify: true},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			a := <-accepted
+			if a.err != nil {
+				t.Fatal(a.err)
+			}
+			server, request := a.conn, a.request
+			defer server.Close()
+
+			if request.Path != "/ws" || request.Query().Get("session") != "1" {
+				t.Fatalf("unexpected request: %s", request)
+			}
+
+			if err := client.WriteMessage(BinaryMessage, []byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			if mt, data, err := server.ReadMessage(); err != nil || mt != BinaryMessage || string(data) != "ping" {
+				t.Fatalf("server read %d %q %v", mt, data, err)
+			}
+
+			if err := server.WriteMessage(BinaryMessage, []byte("pong")); err != nil {
+				t.Fatal(err)
+			}
+			if mt, data, err := client.ReadMessage(); err != nil || mt != BinaryMessage || string(data) != "pong" {
+				t.Fatalf("client read %d %q %v", mt, data, err)
+			}
+
+			server.Close()
+			_, _, err = client.ReadMessage()
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				t.Fatalf("expect close error, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestH2RequiresHTTP2(t *testing.T) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := Listen(&url.URL{Scheme: "tls", Host: "127.0.0.1:0"}, &ListenConfig{
+		TLS: &tls.Config{Certificates: []tls.Certificate{cert}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accept(listener)
+
+	// the tls transport speaks no http/2
+	if _, err := Dial(&url.URL{Scheme: "h2", Host: listener.Addr().String(), Path: "/ws"}, &DialConfig{
+		TLS: &tls.Config{InsecureSkipVerify: true},
+	}); err == nil {
+		t.Fatal("expect h2 to fail without http/2")
+	}
+}
+
+type accepted struct {
+	conn    Conn
+	request *url.URL
+	err     error
+}
+
+// accept accepts one link and reads its request as the relay does,
+// the tls handshake happens on the first read.
+func accept(listener Listener) <-chan accepted {
+	ch := make(chan accepted, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			ch <- accepted{err: err}
+			return
+		}
+
+		request, err := ReadRequest(conn)
+		if err != nil {
+			conn.Close()
+		}
+		ch <- accepted{conn, request, err}
+	}()
+
+	return ch
+}
+
+func TestQUICStreamsOfClosedConnections(t *testing.T) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(n int64) { maxStreams = n }(maxStreams)
+	maxStreams = 16
+
+	// frames are key:data, close ends the key
+	stream := func(frame []byte) (string, bool) {
+		key, data, _ := strings.Cut(string(frame), ":")
+		return key, data == "close"
+	}
+
+	listener, err := Listen(&url.URL{Scheme: "quic", Host: "127.0.0.1:0"}, &ListenConfig{
+		TLS:    &tls.Config{Certificates: []tls.Certificate{cert}},
+		Stream: stream,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	accepted := accept(listener)
+	client, err := Dial(&url.URL{Scheme: "quic", Host: listener.Addr().String(), Path: "/ws"}, &DialConfig{
+		TLS:    &tls.Config{InsecureSkipVerify: true},
+		Stream: stream,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	a := <-accepted
+	if a.err != nil {
+		t.Fatal(a.err)
+	}
+	server := a.conn
+	defer server.Close()
+
+	write := func(conn Conn, frame string) {
+		if err := conn.WriteMessage(BinaryMessage, []byte(frame)); err != nil {
+			t.Error(err)
+		}
+	}
+	read := func(conn Conn, frame string) {
+		if _, data, err := conn.ReadMessage(); err != nil || string(data) != frame {
+			t.Errorf("expect %q, but got %q %v", frame, data, err)
+		}
+	}
+
+	// both sides write each connection, either side closes it, the other one only receives the close
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 0; i < int(maxStreams)*4 && !t.Failed(); i++ {
+			closer, other := client, server
+			if i%2 == 1 {
+				closer, other = server, client
+			}
+
+			key := fmt.Sprintf("%d", i)
+			write(closer, key+":data")
+			read(other, key+":data")
+			write(other, key+":data")
+			read(closer, key+":data")
+			write(closer, key+":close")
+			read(other, key+":close")
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout, streams of closed connections are not released")
+	}
+}
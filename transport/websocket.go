@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWebSocket connects to the relay by websocket, frames are binary messages.
+func dialWebSocket(u *url.URL, cfg *DialConfig) (Conn, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.Proxy = cfg.Proxy
+	if cfg.TLS != nil {
+		dialer.TLSClientConfig = cfg.TLS
+	}
+
+	conn, response, err := dialer.Dial(u.String(), cfg.Header)
+	if err != nil {
+		if response == nil {
+			return nil, fmt.Errorf("failed to connect websocket at %s (error: %s)", u.String(), err)
+		}
+
+		body, errB := ioutil.ReadAll(response.Body)
+		if errB != nil {
+			return nil, fmt.Errorf("failed to connect websocket at %s (status: %s, error: %s)", u.String(), response.Status, err)
+		}
+
+		return nil, fmt.Errorf("failed to connect websocket at %s (status: %d, response: %s, error: %v)", u.String(), response.StatusCode, string(body), err)
+	}
+	defer response.Body.Close()
+
+	return conn, nil
+}
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"sync"
@@ -40,9 +41,19 @@ type User struct {
 	ClientSecret string
 	// Length 10
 	PairKey string
+	// CertSubject is the name of client certificates of the user, see MatchCertificate
+	CertSubject string
 	//
 	// isOnline bool
 	WSClient *connection.WSClient
+	// Session is the id of the client session, links of the same session are one client
+	Session string
+	// links are the websocket links of the session, WSClient is the first alive one
+	links []*connection.WSClient
+	// pins are the links of connections, by connection id, see Pin
+	pins map[string]*connection.WSClient
+	// byToken is true if the session is authenticated by token, which has no crypto
+	byToken bool
 }
 
 type UserClient struct {
@@ -52,6 +63,9 @@ type UserClient struct {
 	ClientSecret string `config:"client_secret"`
 	// Length 10
 	PairKey string `config:"pair_key"`
+	// CertSubject is the common name or SAN (dns, email or uri) of client certificates
+	// identifying the user, default client_id
+	CertSubject string `config:"cert_subject"`
 }
 
 func New(clientID, clientSecret, pairKey string) *User {
@@ -95,6 +109,30 @@ func (u *User) Verify(timestamp, nonce, signature string) (bool, error) {
 	}
 }
 
+// MatchCertificate returns true if cert identifies the user, its common name
+// or any SAN is CertSubject, or the client id if CertSubject is empty.
+func (u *User) MatchCertificate(cert *x509.Certificate) bool {
+	subject := u.CertSubject
+	if subject == "" {
+		subject = u.ClientID
+	}
+
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, name := range names {
+		if name != "" && name == subject {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (u *User) GetClientID() string {
 	return u.ClientID
 }
@@ -108,6 +146,13 @@ func (u *User) GetPairKey() string {
 }
 
 func (u *User) IsOnline() bool {
+	u.RLock()
+	defer u.RUnlock()
+
+	return u.isOnline()
+}
+
+func (u *User) isOnline() bool {
 	if u.WSClient == nil {
 		return false
 	}
@@ -115,47 +160,207 @@ func (u *User) IsOnline() bool {
 	return u.WSClient.IsAlive()
 }
 
-func (u *User) WritePacket(packet *base.Base) error {
-	if !u.IsOnline() {
-		return errors.New("user is not online")
+// GetLink returns the link used by connection, the one pinned if any,
+// frames of unknown connections are spread over the alive links by hash of id.
+func (u *User) GetLink(connectionID string) *connection.WSClient {
+	u.RLock()
+	defer u.RUnlock()
+
+	if link, ok := u.pins[connectionID]; ok {
+		return link
 	}
 
+	return u.hashLink(connectionID)
+}
+
+// Pin keeps connection on link until Release, or until the link leaves,
+// nil link chooses one of the alive links by hash of id.
+// Frames of one connection must not move between links, nothing orders them across links.
+func (u *User) Pin(connectionID string, link *connection.WSClient) {
+	u.Lock()
+	defer u.Unlock()
+
+	if link == nil {
+		link = u.hashLink(connectionID)
+	}
+	if link == nil {
+		return
+	}
+
+	if u.pins == nil {
+		u.pins = map[string]*connection.WSClient{}
+	}
+	u.pins[connectionID] = link
+}
+
+// Release unpins connection, once it is closed.
+func (u *User) Release(connectionID string) {
+	u.Lock()
+	defer u.Unlock()
+
+	delete(u.pins, connectionID)
+}
+
+func (u *User) hashLink(connectionID string) *connection.WSClient {
+	alive := make([]*connection.WSClient, 0, len(u.links))
+	for _, link := range u.links {
+		if link.IsAlive() {
+			alive = append(alive, link)
+		}
+	}
+
+	if len(alive) == 0 {
+		return u.WSClient
+	}
+
+	return alive[connection.LinkIndex(connectionID, len(alive))]
+}
+
+func (u *User) WritePacket(packet *base.Base) error {
+	return u.WritePacketTo("", packet)
+}
+
+// WritePacketTo writes packet on the link of connection.
+func (u *User) WritePacketTo(connectionID string, packet *base.Base) error {
 	if bytes, err := packet.Encode(); err != nil {
 		return fmt.Errorf("failed to encode packet %v", err)
 	} else {
-		return u.WSClient.WriteBinary(bytes)
+		return u.WriteBytesTo(connectionID, bytes)
 	}
 }
 
 func (u *User) WriteBytes(b []byte) error {
-	u.Lock()
-	defer u.Unlock()
+	return u.WriteBytesTo("", b)
+}
 
+// WriteBytesTo writes bytes on the link of connection,
+// writes on one link are serialized by the link itself.
+func (u *User) WriteBytesTo(connectionID string, b []byte) error {
 	if !u.IsOnline() {
 		return errors.New("user is not online")
 	}
 
-	return u.WSClient.WriteBinary(b)
+	link := u.GetLink(connectionID)
+	if link == nil {
+		return errors.New("user is not online")
+	}
+
+	return link.WriteBinary(b)
 }
 
 func (u *User) SetOnline(client *connection.WSClient) error {
-	if u.WSClient != nil {
-		if u.WSClient.IsAlive() {
+	return u.Join("", client)
+}
+
+// Join adds the link to session, the first link sets the user online,
+// links of other sessions are not allowed while online.
+func (u *User) Join(session string, client *connection.WSClient) error {
+	return u.join(session, client, false)
+}
+
+// JoinByToken is Join for links authenticated by token,
+// links of one session are all by token or none.
+func (u *User) JoinByToken(session string, client *connection.WSClient) error {
+	return u.join(session, client, true)
+}
+
+func (u *User) join(session string, client *connection.WSClient, byToken bool) error {
+	u.Lock()
+	defer u.Unlock()
+
+	if u.isOnline() {
+		if session == "" || session != u.Session {
 			return fmt.Errorf("not allow login, because user is online before in other place")
 		}
+
+		if byToken != u.byToken {
+			return fmt.Errorf("not allow login, because links of the session are authenticated otherwise")
+		}
+
+		u.links = append(u.links, client)
+		return nil
 	}
 
+	u.Session = session
 	u.WSClient = client
+	u.links = []*connection.WSClient{client}
+	u.byToken = byToken
 	return nil
 }
 
+// ByToken returns true if the session is authenticated by token,
+// packets to it are not encrypted, the client secret is not known there.
+func (u *User) ByToken() bool {
+	u.RLock()
+	defer u.RUnlock()
+
+	return u.byToken
+}
+
+// Leave removes the link from session, returns the number of links left,
+// and the connections pinned to links gone, which are unpinned, they cannot move to other links.
+// The user is offline once no link left.
+func (u *User) Leave(client *connection.WSClient) (int, []string) {
+	u.Lock()
+	defer u.Unlock()
+
+	links := make([]*connection.WSClient, 0, len(u.links))
+	for _, link := range u.links {
+		if link.Client != client.Client && link.IsAlive() {
+			links = append(links, link)
+		}
+	}
+	u.links = links
+
+	dropped := []string{}
+	for id, pinned := range u.pins {
+		kept := false
+		for _, link := range links {
+			if link.Client == pinned.Client {
+				kept = true
+				break
+			}
+		}
+
+		if !kept {
+			delete(u.pins, id)
+			dropped = append(dropped, id)
+		}
+	}
+
+	if len(links) == 0 {
+		u.WSClient = nil
+		u.Session = ""
+		return 0, dropped
+	}
+
+	u.WSClient = links[0]
+	return len(links), dropped
+}
+
+// Links returns the number of links in session.
+func (u *User) Links() int {
+	u.RLock()
+	defer u.RUnlock()
+
+	return len(u.links)
+}
+
 func (u *User) SetOffline() error {
-	if u.IsOnline() {
-		if err := u.WSClient.Disconnect(); err != nil {
-			logger.Warnf("failed disconnect ws client")
+	u.Lock()
+	defer u.Unlock()
+
+	for _, link := range u.links {
+		if link.IsAlive() {
+			if err := link.Disconnect(); err != nil {
+				logger.Warnf("failed disconnect ws client")
+			}
 		}
 	}
 
 	u.WSClient = nil
+	u.Session = ""
+	u.links = nil
+	u.pins = nil
 	return nil
 }